@@ -0,0 +1,22 @@
+#!/usr/bin/env bash
+# Actions of [ContainerApp] exported by Shell-Bun from export_container.cfg
+# Usage: $0 {build|run}
+
+set -uo pipefail
+
+action_build() {
+    docker run --rm -v /src:/src builder bash -lc 'cd '\''/src/app'\'' && make all'
+}
+
+action_run() {
+    docker run --rm -v /src:/src builder bash -lc 'cd '\''/src/app'\'' && ./run.sh --port 8080'
+}
+
+case "${1:-}" in
+    'build') action_build ;;
+    'run') action_run ;;
+    *)
+        echo "Usage: $0 {build|run}" >&2
+        exit 1
+        ;;
+esac
@@ -0,0 +1,30 @@
+#!/usr/bin/env bash
+# Actions of [ExportApp] exported by Shell-Bun from export.cfg
+# Usage: $0 {build|test|lint-all}
+
+set -uo pipefail
+
+action_build() {
+    cd '/tmp' || exit 1
+    bash -c 'echo "Building ExportApp in $(pwd)"'
+}
+
+action_test() {
+    cd '/tmp' || exit 1
+    bash -c 'echo '\''it'\''"'\''"'\''s tested'\'' && exit 3'
+}
+
+action_lint_all() {
+    cd '/tmp' || exit 1
+    bash -c 'echo linting'
+}
+
+case "${1:-}" in
+    'build') action_build ;;
+    'test') action_test ;;
+    'lint-all') action_lint_all ;;
+    *)
+        echo "Usage: $0 {build|test|lint-all}" >&2
+        exit 1
+        ;;
+esac
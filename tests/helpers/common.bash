@@ -0,0 +1,19 @@
+#!/usr/bin/env bash
+
+# Setup shared by every test file. Load it and call it first thing in setup():
+#
+#   setup() {
+#       load helpers/common
+#       common_setup
+#       ...
+#   }
+
+# Function to isolate a test from the developer's own Shell-Bun data
+common_setup() {
+    # Test configs are written on the fly and never trusted; test_trust.bats
+    # unsets this to test the check itself
+    export SHELL_BUN_NO_TRUST_CHECK=1
+    # Trust records, history.jsonl and per-config data go in the test's own
+    # directory instead of ~/.local/state/shell-bun
+    export XDG_STATE_HOME="$BATS_TEST_TMPDIR/xdg-state"
+}
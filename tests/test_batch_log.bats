@@ -0,0 +1,75 @@
+#!/usr/bin/env bats
+
+# Test the log of a whole menu batch and moving between its sections in the log viewer
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_CONFIG="$BATS_TEST_TMPDIR/batch.cfg"
+    LOG_DIR="$BATS_TEST_TMPDIR/logs"
+
+    # The interactive UI needs a terminal; util-linux 'script' provides one
+    if ! script -qec true /dev/null >/dev/null 2>&1; then
+        skip "util-linux 'script' is required to emulate a terminal"
+    fi
+
+    # package starts after build; the long output keeps the next section off the first screen
+    cat > "$TEST_CONFIG" << EOF
+log_dir=$LOG_DIR
+
+[Portal]
+build=echo "Building Portal"; seq 1 60
+package=echo "Packaging Portal"; exit 2
+package.after=build
+EOF
+}
+
+# Select every action, run them, then feed the given log viewer keys and, once
+# less is open, the given less keys
+run_batch_then_keys() {
+    local keys="$1"
+    local less_keys="${2:-}"
+    run bash -c "(sleep 1; printf '+'; sleep 0.3; printf '\r'; sleep 4; printf '$keys'; sleep 1; printf '$less_keys'; sleep 0.5; printf 'q'; sleep 0.3; printf '\033'; sleep 0.3) | script -qec \"stty rows 30 cols 200; bash '$SHELL_BUN' --no-trust-check '$TEST_CONFIG'\" /dev/null"
+}
+
+@test "A batch writes one log with a section per action in the order they started" {
+    run_batch_then_keys ''
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "BATCH: 2 actions, one section each ($LOG_DIR/"[0-9_]+"_batch.log)" ]]
+    run cat "$LOG_DIR"/*_batch.log
+    [ "${lines[0]}" = "[shell-bun] Batch of 2 actions, in the order they started: Portal - build, Portal - package" ]
+    [[ "$output" =~ "[shell-bun] ===== ✔ Portal build "[0-9]+m?"s ====="$'\n'"Building Portal" ]]
+    [[ "$output" =~ "[shell-bun] ===== ✘ Portal package "[0-9]+m?"s (exit 2) ====="$'\n'"Packaging Portal" ]]
+    [ "$(grep -n '^60$' "$LOG_DIR"/*_batch.log | cut -d: -f1)" -lt "$(grep -n '^Packaging Portal$' "$LOG_DIR"/*_batch.log | cut -d: -f1)" ]
+    [ "${lines[${#lines[@]} - 1]}" = "[shell-bun] ===== Batch finished: 1 successful, 1 failed =====" ]
+    # The actions keep their own logs
+    [ -f "$LOG_DIR"/*_Portal_build.log ]
+    [ -f "$LOG_DIR"/*_Portal_package.log ]
+}
+
+@test "The batch log opens at its first section and ] and [ move between sections" {
+    if [[ "$(less --version 2>/dev/null | sed -n '1s/^less \([0-9]*\).*/\1/p')" -lt 582 ]]; then
+        skip "less 582 or newer is required for the key bindings"
+    fi
+    # Up from the first result reaches the batch log
+    run_batch_then_keys '\033[A\r'
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Building Portal" ]]
+    [[ ! "$output" =~ "Packaging Portal" ]]
+
+    run_batch_then_keys '\033[A\r' ']'
+    [[ "$output" =~ "Packaging Portal" ]]
+
+    run_batch_then_keys '\033[A\r' ']['
+    [[ "$output" =~ "Packaging Portal"[^$'\n']*$'\r'*$'\n'.*"Building Portal" ]]
+}
+
+@test "A single action does not write a batch log" {
+    sed -i '/^package/d' "$TEST_CONFIG"
+    run_batch_then_keys ''
+    [ "$status" -eq 0 ]
+    [[ ! "$output" =~ "BATCH:" ]]
+    [ -z "$(find "$LOG_DIR" -name '*_batch.log')" ]
+}
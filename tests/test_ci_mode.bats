@@ -3,6 +3,8 @@
 # Test CI mode (non-interactive) functionality
 
 setup() {
+    load helpers/common
+    common_setup
     SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
     SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
     TEST_FIXTURES="$SCRIPT_DIR/tests/fixtures"
@@ -64,15 +66,67 @@ setup() {
     [[ ! "$output" =~ "CI Execution Summary" ]]
 }
 
+@test "CI mode: Negated patterns exclude matches wherever they appear" {
+    run bash "$SHELL_BUN" --ci "!App2,*" "all,!clean" "$TEST_FIXTURES/basic.cfg"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Matched apps: TestApp1" ]]
+    [[ "$output" =~ "Building TestApp1" ]]
+    [[ "$output" =~ "Testing TestApp1" ]]
+    [[ ! "$output" =~ "Cleaning TestApp1" ]]
+    [[ ! "$output" =~ "Starting: TestApp2" ]]
+    [[ "$output" =~ "Excluded apps: TestApp2" ]]
+}
+
+@test "CI mode: A list of only negations starts from every candidate" {
+    run bash "$SHELL_BUN" --ci "*" "^test,^deploy,!nothing" "$TEST_FIXTURES/basic.cfg"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Building TestApp1" ]]
+    [[ "$output" =~ "Cleaning TestApp1" ]]
+    [[ "$output" =~ "Building TestApp2" ]]
+    [[ ! "$output" =~ "Testing TestApp1" ]]
+    [[ ! "$output" =~ "Deploying TestApp2" ]]
+
+    run bash "$SHELL_BUN" --ci "App1,!TestApp1" build "$TEST_FIXTURES/basic.cfg"
+    [ "$status" -eq 3 ]
+    [[ "$output" =~ "No applications found matching pattern 'App1,!TestApp1'" ]]
+}
+
+@test "CI mode: --exclude leaves out apps and the header lists the excluded ones" {
+    run bash "$SHELL_BUN" --ci "*" "build,test" --exclude App2 "$TEST_FIXTURES/basic.cfg"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "App pattern: '*,!App2'" ]]
+    [[ "$output" =~ "Matched apps: TestApp1" ]]
+    [[ "$output" =~ "Excluded apps: TestApp2" ]]
+    [[ ! "$output" =~ "Building TestApp2" ]]
+
+    # Repeated, with a leading ! or ^, or as --exclude=
+    run bash "$SHELL_BUN" --ci "Test*" build --exclude='^App1' --exclude "!App2" "$TEST_FIXTURES/basic.cfg"
+    [ "$status" -eq 3 ]
+    [[ "$output" =~ "No applications found matching pattern 'Test*,!App1,!App2'" ]]
+
+    # Exclusions in the pattern are listed too, and none when they match nothing
+    run bash "$SHELL_BUN" --ci "*,!Nothing" build "$TEST_FIXTURES/basic.cfg"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Excluded apps: none" ]]
+    run bash "$SHELL_BUN" --ci "*" build "$TEST_FIXTURES/basic.cfg"
+    [[ ! "$output" =~ "Excluded apps" ]]
+}
+
+@test "CI mode: --exclude requires --ci" {
+    run bash "$SHELL_BUN" --exclude App2 "$TEST_FIXTURES/basic.cfg"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "Error: --exclude requires --ci APP_PATTERN ACTION_PATTERN" ]]
+}
+
 @test "CI mode: Error on non-existent app" {
     run bash "$SHELL_BUN" --ci NonExistentApp build "$TEST_FIXTURES/basic.cfg"
-    [ "$status" -eq 1 ]
+    [ "$status" -eq 3 ]
     [[ "$output" =~ "No applications found matching pattern" ]]
 }
 
 @test "CI mode: Error on non-existent action" {
     run bash "$SHELL_BUN" --ci TestApp1 nonexistent "$TEST_FIXTURES/basic.cfg"
-    [ "$status" -eq 1 ]
+    [ "$status" -eq 3 ]
     [[ "$output" =~ "No actions found" ]]
 }
 
@@ -105,3 +159,83 @@ setup() {
     [[ "$output" =~ "Action(s) required" ]]
 }
 
+
+@test "CI mode: Completion is reported as each action finishes, with duration" {
+    cat > "$BATS_TEST_TMPDIR/stream.cfg" << 'EOF2'
+[StreamApp]
+slow=sleep 2; echo "slow done"
+fast=echo "fast done"
+EOF2
+    run bash "$SHELL_BUN" --ci StreamApp slow,fast "$BATS_TEST_TMPDIR/stream.cfg"
+    [ "$status" -eq 0 ]
+    # Actions start in selection order
+    [[ "$output" =~ "Starting: StreamApp - slow"[^✅]*"Starting: StreamApp - fast" ]]
+    # The fast action is reported before the slow one has produced output
+    [[ "$output" =~ "Completed: StreamApp - fast ("[0-9]+m?s")"[^✅]*"slow done" ]]
+    [[ "$output" =~ "Completed: StreamApp - slow ("[0-9]+s")" ]]
+    [[ "$output" =~ "Successful operations: 2" ]]
+}
+
+@test "CI mode: Heartbeat is printed while nothing completes" {
+    cat > "$BATS_TEST_TMPDIR/heartbeat.cfg" << 'EOF2'
+ci_heartbeat=1
+
+[SlowApp]
+wait=sleep 3
+EOF2
+    run bash "$SHELL_BUN" --ci SlowApp wait "$BATS_TEST_TMPDIR/heartbeat.cfg"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Still running (1 of 1, "[0-9]+s" elapsed): SlowApp - wait" ]]
+    [[ "$output" =~ "Completed: SlowApp - wait" ]]
+}
+
+@test "CI mode: Lines of concurrent actions are not interleaved" {
+    cat > "$BATS_TEST_TMPDIR/lines.cfg" << 'EOF2'
+[LineApp]
+a=for i in $(seq 300); do printf 'AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA\n'; done
+b=for i in $(seq 300); do printf 'BBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBB\n'; done
+EOF2
+    run bash "$SHELL_BUN" --ci LineApp a,b "$BATS_TEST_TMPDIR/lines.cfg"
+    [ "$status" -eq 0 ]
+    [ "$(grep -c '^A\{62\}$' <<< "$output")" -eq 300 ]
+    [ "$(grep -c '^B\{62\}$' <<< "$output")" -eq 300 ]
+}
+
+@test "CI mode: Failed actions are classified by the first matching rule" {
+    run bash "$SHELL_BUN" --ci ClassifyApp all "$TEST_FIXTURES/classify.cfg"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "  - ClassifyApp - compile [compile]" ]]
+    [[ "$output" =~ "  - ClassifyApp - unit [test]" ]]
+    [[ "$output" =~ "  - ClassifyApp - both [compile]" ]]
+    [[ "$output" =~ "  - ClassifyApp - other [unknown]" ]]
+    [[ ! "$output" =~ "ClassifyApp - fine [" ]]
+}
+
+@test "CI mode: Invalid classification regexes are reported and skipped" {
+    cat > "$BATS_TEST_TMPDIR/bad_rule.cfg" << 'EOF2'
+classify.broken=([
+[App]
+fail=exit 1
+EOF2
+    run bash "$SHELL_BUN" --ci App fail "$BATS_TEST_TMPDIR/bad_rule.cfg"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "Ignoring classify.broken: invalid regex '(['" ]]
+}
+
+@test "CI mode: Extracted fields are shown after the duration" {
+    run bash "$SHELL_BUN" --ci ExtractApp test,lint,size "$TEST_FIXTURES/extract.cfg"
+    [ "$status" -eq 1 ]
+    # The last match wins, \d and \s work, and a regex without a group shows the whole match
+    [[ "$output" =~ "Failed: ExtractApp - test ("[0-9]+m?"s) passed=412 failed=3" ]]
+    [[ "$output" =~ "Completed: ExtractApp - lint ("[0-9]+m?"s) warnings=7" ]]
+    [[ "$output" =~ "Completed: ExtractApp - size ("[0-9]+m?"s) kb=2048 KB" ]]
+    # Fields without a match are left out
+    [[ ! "$output" =~ "errors=" ]]
+}
+
+@test "CI mode: An invalid extraction regex does not fail the action" {
+    run bash "$SHELL_BUN" --ci ExtractApp broken "$TEST_FIXTURES/extract.cfg"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Completed: ExtractApp - broken" ]]
+    [[ ! "$output" =~ "count=" ]]
+}
@@ -3,6 +3,8 @@
 # Test command-line argument parsing
 
 setup() {
+    load helpers/common
+    common_setup
     SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
     SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
 }
@@ -42,8 +44,8 @@ setup() {
 
 @test "Debug mode flag" {
     # Debug mode should work with CI mode
-    run bash "$SHELL_BUN" --debug --ci TestApp1 build tests/fixtures/basic.cfg
-    # Check that debug.log is created (we can't easily check its contents in this test)
+    run bash "$SHELL_BUN" --state-dir "$BATS_TEST_TMPDIR/state" --debug --ci TestApp1 build tests/fixtures/basic.cfg
+    # debug.log is written to the state dir (see test_state_dir.bats)
     # Status depends on whether the command succeeds
 }
 
@@ -0,0 +1,64 @@
+#!/usr/bin/env bats
+
+# Test finding shell-bun.cfg in a parent of the working directory, and --no-discover
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    PROJECT_DIR="$BATS_TEST_TMPDIR/project"
+    mkdir -p "$PROJECT_DIR/src/module"
+    cat > "$PROJECT_DIR/shell-bun.cfg" << 'EOF'
+[Project]
+where=echo "project config"
+EOF
+}
+
+@test "shell-bun.cfg of a parent directory is used without a config argument" {
+    cd "$PROJECT_DIR/src/module"
+    run bash "$SHELL_BUN" --ci Project where --no-trust-check
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Loading configuration from: $PROJECT_DIR/shell-bun.cfg" ]]
+    [[ "$output" =~ "project config" ]]
+}
+
+@test "The nearest shell-bun.cfg wins" {
+    cat > "$PROJECT_DIR/src/shell-bun.cfg" << 'EOF'
+[Source]
+where=echo "source config"
+EOF
+    cd "$PROJECT_DIR/src/module"
+    run bash "$SHELL_BUN" --ci Source where --no-trust-check
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "source config" ]]
+}
+
+@test "--no-discover only looks in the working directory" {
+    cd "$PROJECT_DIR/src/module"
+    run bash "$SHELL_BUN" --ci Project where --no-trust-check --no-discover
+    [ "$status" -eq 2 ]
+    [[ "$output" =~ "Error: Configuration file 'shell-bun.cfg' not found!" ]]
+}
+
+@test "A missing config names the directories searched" {
+    cd "$BATS_TEST_TMPDIR"
+    run bash "$SHELL_BUN" --ci Project where --no-trust-check
+    [ "$status" -eq 2 ]
+    [[ "$output" =~ "not found in $BATS_TEST_TMPDIR or any parent directory" ]]
+}
+
+@test "--validate shows where the config was found" {
+    cd "$PROJECT_DIR/src/module"
+    run bash "$SHELL_BUN" --validate --no-trust-check
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Validating configuration: $PROJECT_DIR/shell-bun.cfg" ]]
+    [[ "$output" =~ "Found above the working directory ($PROJECT_DIR/src/module)" ]]
+}
+
+@test "A config file argument is not looked up in parent directories" {
+    cd "$PROJECT_DIR/src/module"
+    run bash "$SHELL_BUN" --ci Project where --no-trust-check other.cfg
+    [ "$status" -eq 2 ]
+    [[ "$output" =~ "Error: Configuration file 'other.cfg' not found!" ]]
+}
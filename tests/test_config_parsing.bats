@@ -3,6 +3,8 @@
 # Test configuration parsing functionality
 
 setup() {
+    load helpers/common
+    common_setup
     SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
     SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
     TEST_FIXTURES="$SCRIPT_DIR/tests/fixtures"
@@ -22,13 +24,13 @@ setup() {
 
 @test "Reject configuration with no apps" {
     run bash "$SHELL_BUN" --ci TestApp1 build "$TEST_FIXTURES/invalid.cfg"
-    [ "$status" -eq 1 ]
+    [ "$status" -eq 2 ]
     [[ "$output" =~ "No applications found" ]]
 }
 
 @test "Error on missing configuration file" {
     run bash "$SHELL_BUN" --ci TestApp1 build /nonexistent/config.cfg
-    [ "$status" -eq 1 ]
+    [ "$status" -eq 2 ]
     [[ "$output" =~ "Configuration file" ]] && [[ "$output" =~ "not found" ]]
 }
 
@@ -45,3 +47,82 @@ setup() {
     [[ "$output" =~ "Container mode enabled" ]]
 }
 
+
+@test "Strip Windows (CRLF) line endings from values" {
+    run bash "$SHELL_BUN" --ci WinApp pwd "$TEST_FIXTURES/crlf.cfg"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Completed: WinApp - pwd" ]]
+    [[ "$output" =~ "/tmp"$'\r'?$'\n' ]]
+    [[ ! "$output" =~ "bash -c pwd"$'\r' ]]
+}
+
+@test "Transcode UTF-16LE configuration files" {
+    run bash "$SHELL_BUN" --ci WideApp build "$TEST_FIXTURES/utf16le.cfg"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "appears to be UTF-16LE encoded" ]]
+    [[ "$output" =~ "Building WideApp" ]]
+}
+
+@test "Reject UTF-16 configuration files that cannot be transcoded" {
+    mkdir -p "$BATS_TEST_TMPDIR/bin"
+    printf '#!/bin/sh\nexit 1\n' > "$BATS_TEST_TMPDIR/bin/iconv"
+    chmod +x "$BATS_TEST_TMPDIR/bin/iconv"
+    PATH="$BATS_TEST_TMPDIR/bin:$PATH" run bash "$SHELL_BUN" --ci WideApp build "$TEST_FIXTURES/utf16le.cfg"
+    [ "$status" -eq 2 ]
+    [[ "$output" =~ "appears to be UTF-16LE encoded" ]]
+    [[ "$output" =~ "save it as UTF-8" ]]
+    [[ ! "$output" =~ "Building WideApp" ]]
+}
+
+@test "Warn about names that cannot be addressed from --ci" {
+    run bash "$SHELL_BUN" --ci GoodApp test "$TEST_FIXTURES/bad_names.cfg"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "App name 'Web*App' ($TEST_FIXTURES/bad_names.cfg:2) contains '*' (glob metacharacter)" ]]
+    [[ "$output" =~ "Action name 'all' in [GoodApp] ($TEST_FIXTURES/bad_names.cfg:6) is the reserved word 'all'" ]]
+    [[ "$output" =~ "Action name 'lint,fix' in [GoodApp] ($TEST_FIXTURES/bad_names.cfg:7) contains ',' (pattern separator)" ]]
+    [[ "$output" =~ "Action name 'deploy:prod' in [GoodApp] ($TEST_FIXTURES/bad_names.cfg:8) contains ':' (reserved separator)" ]]
+    [[ "$output" =~ "Testing GoodApp" ]]
+}
+
+@test "Reject names that cannot be addressed from --ci with --strict" {
+    run bash "$SHELL_BUN" --strict --ci GoodApp test "$TEST_FIXTURES/bad_names.cfg"
+    [ "$status" -eq 2 ]
+    [[ "$output" =~ "Error: App name 'Web*App'" ]]
+    [[ "$output" =~ "Rename the 4 name(s) above" ]]
+    [[ ! "$output" =~ "Testing GoodApp" ]]
+}
+
+@test "Accept well-formed names with --strict" {
+    run bash "$SHELL_BUN" --strict --ci TestApp1 build "$TEST_FIXTURES/basic.cfg"
+    [ "$status" -eq 0 ]
+    [[ ! "$output" =~ "cannot be addressed" ]]
+}
+
+@test "An action defined twice keeps the last command at the place of the first" {
+    cat > "$BATS_TEST_TMPDIR/dup.cfg" << 'EOF2'
+[App]
+test_unit=echo "unit"
+build=echo "first build"
+test=echo "test"
+build=echo "second build"
+EOF2
+    run bash "$SHELL_BUN" --ci App all --explain "$BATS_TEST_TMPDIR/dup.cfg"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "[App] build: action defined twice, at lines 3 and 5; the second definition is used ($BATS_TEST_TMPDIR/dup.cfg:5)" ]]
+    [[ "$output" =~ "Wave 1: App - test_unit, App - build, App - test" ]]
+
+    run bash "$SHELL_BUN" --ci App build "$BATS_TEST_TMPDIR/dup.cfg"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "second build" ]]
+    [[ ! "$output" =~ "first build" ]]
+}
+
+@test "Reject actions defined twice with --strict" {
+    printf '[App]\nbuild=echo "first build"\nbuild=echo "second build"\n' > "$BATS_TEST_TMPDIR/dup.cfg"
+    run bash "$SHELL_BUN" --strict --ci App build "$BATS_TEST_TMPDIR/dup.cfg"
+    [ "$status" -eq 2 ]
+    [[ "$output" =~ "Error: [App] build: action defined twice, at lines 2 and 3 ($BATS_TEST_TMPDIR/dup.cfg:3)" ]]
+    [[ "$output" =~ "Remove or rename the 1 action(s) defined twice above, or run without --strict to use the last definition of each." ]]
+    [[ ! "$output" =~ "Rename the" ]]
+    [[ ! "$output" =~ "second build" ]]
+}
@@ -0,0 +1,119 @@
+#!/usr/bin/env bats
+
+# Test ${NAME}, {{NAME}}, var_NAME and [variables] variables and ${cfg:base_dir} in config values
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    PROJECT="$BATS_TEST_TMPDIR/project"
+    TEST_CONFIG="$PROJECT/shell-bun.cfg"
+    mkdir -p "$PROJECT/src" "$PROJECT/tools"
+    export SB_TEST_LOGS="$BATS_TEST_TMPDIR/logs"
+
+    cat > "$TEST_CONFIG" << 'EOF'
+log_dir=${SB_TEST_LOGS}/app-logs
+
+[App]
+working_dir=${cfg:base_dir}/src
+build=echo "building in $PWD with ${cfg:base_dir}/tools"
+home=echo "home is ${HOME}"
+EOF
+}
+
+@test "Paths expand environment variables and \${cfg:base_dir}" {
+    run bash "$SHELL_BUN" --ci App build "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "building in $PROJECT/src with $PROJECT/tools" ]]
+
+    run bash "$SHELL_BUN" --validate "$TEST_CONFIG"
+    [[ "$output" =~ "log_dir: $SB_TEST_LOGS/app-logs does not exist yet" ]]
+}
+
+@test "Commands leave other \${NAME}s to the shell" {
+    run bash "$SHELL_BUN" --ci App home --dry-run "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ 'home\ is\ \$\{HOME\}' ]]
+
+    run bash "$SHELL_BUN" --ci App home "$TEST_CONFIG"
+    [[ "$output" =~ "home is $HOME" ]]
+}
+
+@test "\${cfg:base_dir} in an included file is that file's directory" {
+    mkdir -p "$PROJECT/shared"
+    cat > "$PROJECT/shared/common.cfg" << 'EOF'
+[Shared]
+where=echo "shared at ${cfg:base_dir}"
+EOF
+    sed -i '1i include=${cfg:base_dir}/shared/common.cfg' "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --ci Shared where "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "shared at $PROJECT/shared" ]]
+}
+
+@test "var_ variables and built-ins are expanded in paths, the container and commands" {
+    cat > "$TEST_CONFIG" << 'EOF'
+var_TOOLS=${CONFIG_DIR}/tools
+var_OUT=${TOOLS}/out
+container=env OUT_DIR=${OUT}
+
+[App]
+working_dir=${CONFIG_DIR}/src
+build=echo "${APP} in $PWD uses ${TOOLS}, out $OUT_DIR, home ${HOME}, [$${TOOLS}]"
+EOF
+    run bash "$SHELL_BUN" --ci App build "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Container mode enabled using: env OUT_DIR=$PROJECT/tools/out" ]]
+    # ${HOME} is left to the shell, as is ${TOOLS} written as $${TOOLS} (not set there)
+    [[ "$output" =~ "App in $PROJECT/src uses $PROJECT/tools, out $PROJECT/tools/out, home $HOME, []" ]]
+}
+
+@test "A [variables] section defines variables for {{NAME}} and \${NAME}" {
+    cat > "$TEST_CONFIG" << 'EOF'
+[variables]
+TOOLS = ${CONFIG_DIR}/tools
+OUT = {{TOOLS}}/out
+
+[App]
+working_dir={{TOOLS}}
+build=echo "in $PWD, out {{OUT}}, ${TOOLS}, {{args}}, {{.Name}}, {{UNSET}}"
+EOF
+    run bash "$SHELL_BUN" --ci App build --no-trust-check "$TEST_CONFIG" -- x
+    [ "$status" -eq 0 ]
+    # {{args}} is still the forwarded arguments; other {{...}} are left as written
+    [[ "$output" =~ "in $PROJECT/tools, out $PROJECT/tools/out, $PROJECT/tools, x, {{.Name}}, {{UNSET}}" ]]
+
+    # The section is not an app
+    run bash -c "bash '$SHELL_BUN' --list --no-trust-check '$TEST_CONFIG' 2>/dev/null"
+    [ "$output" == "App" ]
+}
+
+@test "Unresolved tokens are left as written and reported" {
+    unset SB_TEST_LOGS
+    echo 'lint=${cfg:tools}/lint.sh' >> "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --validate "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "Error: log_dir: \${SB_TEST_LOGS} is neither a var_ variable defined above nor a set environment variable, left as written ($TEST_CONFIG:1)" ]]
+    [[ "$output" =~ "Error: [App] lint: unknown \${cfg:tools}, left as written ($TEST_CONFIG:7)" ]]
+    # Tokens the shell expands are not reported
+    [[ ! "$output" =~ "HOME" ]]
+}
+
+@test "\$\${NAME} is a literal \${NAME} in paths" {
+    sed -i 's|^log_dir=.*|log_dir=${SB_TEST_LOGS}/$${SB_TEST_LOGS}|' "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --validate "$TEST_CONFIG"
+    [[ "$output" =~ "log_dir: $SB_TEST_LOGS/\${SB_TEST_LOGS} does not exist yet" ]]
+    [[ ! "$output" =~ "left as written" ]]
+}
+
+@test "Show Details lists the expanded commands and how they were written" {
+    if ! script -qec true /dev/null >/dev/null 2>&1; then
+        skip "util-linux 'script' is required to emulate a terminal"
+    fi
+    run bash -c "(sleep 1; printf 'details'; sleep 0.3; printf '\\r'; sleep 0.5; printf '\\r'; sleep 0.5; printf '\033'; sleep 0.3) | script -qec \"stty cols 200; bash '$SHELL_BUN' --no-trust-check '$TEST_CONFIG'\" /dev/null"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Working Dir:    $PROJECT/src (written as \${cfg:base_dir}/src)" ]]
+    [[ "$output" =~ "Command: echo \"building in \$PWD with $PROJECT/tools\"" ]]
+    [[ "$output" =~ 'Written as: echo "building in $PWD with ${cfg:base_dir}/tools"' ]]
+}
@@ -0,0 +1,64 @@
+#!/usr/bin/env bats
+
+# Test tags on apps and actions: --with-tags in CI mode and =TAG in the menu filter
+
+load helpers/terminal
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_CONFIG="$BATS_TEST_TMPDIR/config-tags.cfg"
+
+    cat > "$TEST_CONFIG" << 'EOF'
+[Web]
+tags = frontend
+build=echo "web build"
+e2e=echo "web e2e"
+e2e.tags = Slow, browser
+
+[Db]
+migrate=echo "db migrate"
+migrate.tags=destructive,slow
+seed=echo "db seed"
+EOF
+}
+
+@test "Tags: --with-tags runs the matched actions with one of the tags" {
+    run bash "$SHELL_BUN" --no-trust-check --ci "*" all --with-tags slow "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Tags: slow" ]]
+    [[ "$output" =~ "web e2e" ]]
+    [[ "$output" =~ "db migrate" ]]
+    [[ ! "$output" =~ "web build" ]]
+    [[ ! "$output" =~ "db seed" ]]
+
+    # An app's tags apply to all its actions
+    run bash "$SHELL_BUN" --no-trust-check --ci "*" all --with-tags=frontend,destructive "$TEST_CONFIG"
+    [[ "$output" =~ "Running 3 actions in parallel..." ]]
+
+    run bash "$SHELL_BUN" --no-trust-check --ci "*" all --with-tags missing "$TEST_CONFIG"
+    [ "$status" -eq 3 ]
+    [[ "$output" =~ "Error: No actions found matching pattern 'all' with one of the tags missing" ]]
+}
+
+@test "Tags: invalid tags and tags of unknown actions are reported" {
+    printf 'typo.tags=slow\nseed.tags=ok, no!\n' >> "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --no-trust-check --validate "$TEST_CONFIG"
+    [[ "$output" =~ "[Db] typo.tags: no action named 'typo' ($TEST_CONFIG:11)" ]]
+    [[ "$output" =~ "Ignoring tag 'no!' in [Db] seed.tags (only letters, digits, _, . and - are allowed) ($TEST_CONFIG:12)" ]]
+
+    run bash "$SHELL_BUN" --with-tags slow "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "Error: --with-tags requires --ci APP_PATTERN ACTION_PATTERN" ]]
+}
+
+@test "Tags: =TAG in the menu filter keeps the actions with the tag" {
+    require_terminal
+    # + selects what the filter kept; the selection is saved for the next run
+    run_terminal --state-dir "$BATS_TEST_TMPDIR/state" "$TEST_CONFIG" -- = s l + esc
+    run cat "$BATS_TEST_TMPDIR"/state/*/session
+    [[ "$output" =~ "filter==sl" ]]
+    [ "$(grep '^selected=' <<< "$output")" == $'selected=Web - e2e\nselected=Db - migrate' ]
+}
@@ -0,0 +1,111 @@
+#!/usr/bin/env bats
+
+# Test container_persistent: one long-lived container per run, actions via exec
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_CONFIG="$BATS_TEST_TMPDIR/persistent.cfg"
+    export FAKE_DOCKER_LOG="$BATS_TEST_TMPDIR/docker.log"
+
+    # A fake runtime that records its calls and runs the commands on the host
+    mkdir -p "$BATS_TEST_TMPDIR/bin"
+    cat > "$BATS_TEST_TMPDIR/bin/docker" << 'EOF'
+#!/bin/bash
+echo "$*" >> "$FAKE_DOCKER_LOG"
+case "$1" in
+    run)
+        if [[ "$2" == "-d" ]]; then
+            [[ -n "${FAKE_DOCKER_FAIL_START:-}" ]] && { echo "cannot connect to the daemon" >&2; exit 1; }
+            echo "abc123def4567890"
+            exit 0
+        fi
+        while [[ $# -gt 0 && "$1" != "bash" ]]; do shift; done
+        exec bash -c "$3"
+        ;;
+    exec)
+        [[ -n "${FAKE_DOCKER_FAIL_EXEC:-}" ]] && { echo "container is not running" >&2; exit 1; }
+        exec bash -c "$5"
+        ;;
+esac
+EOF
+    chmod +x "$BATS_TEST_TMPDIR/bin/docker"
+    export PATH="$BATS_TEST_TMPDIR/bin:$PATH"
+
+    cat > "$TEST_CONFIG" << EOF
+container=docker run --rm -it -e FOO=bar ubuntu:24.04
+container_persistent=true
+
+[App]
+working_dir=/tmp
+build=pwd; echo "built"
+test=echo "tested"
+slow=sleep 3
+EOF
+}
+
+@test "Actions run via exec in one container that is removed at the end" {
+    run bash "$SHELL_BUN" --ci App build,test "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Started persistent container abc123def456" ]]
+    [[ "$output" =~ "built" ]]
+    [[ "$output" =~ "tested" ]]
+    [ "$(grep -c '^run ' "$FAKE_DOCKER_LOG")" -eq 1 ]
+    grep -qx "run -d --rm -e FOO=bar ubuntu:24.04 sleep infinity" "$FAKE_DOCKER_LOG"
+    grep -qx "exec abc123def4567890 bash -lc cd /tmp && pwd; echo \"built\"" "$FAKE_DOCKER_LOG"
+    grep -qx "exec abc123def4567890 bash -lc cd /tmp && echo \"tested\"" "$FAKE_DOCKER_LOG"
+    [ "$(tail -n 1 "$FAKE_DOCKER_LOG")" = "rm -f abc123def4567890" ]
+}
+
+@test "container_start replaces the derived start command" {
+    sed -i '2a container_start=docker run -d --name builder ubuntu:24.04 sleep 3600' "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --ci App test "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    grep -qx "run -d --name builder ubuntu:24.04 sleep 3600" "$FAKE_DOCKER_LOG"
+    grep -q "^exec abc123def4567890 bash -lc" "$FAKE_DOCKER_LOG"
+}
+
+@test "A container that does not start falls back to one container per action" {
+    FAKE_DOCKER_FAIL_START=1 run bash "$SHELL_BUN" --ci App build "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Could not start a persistent container (cannot connect to the daemon); starting a container per action" ]]
+    [[ "$output" =~ "built" ]]
+    grep -q "^run --rm -it -e FOO=bar ubuntu:24.04 bash -lc" "$FAKE_DOCKER_LOG"
+}
+
+@test "A failed preflight exec falls back and removes the container" {
+    FAKE_DOCKER_FAIL_EXEC=1 run bash "$SHELL_BUN" --ci App build "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "failed a preflight check (container is not running)" ]]
+    [[ "$output" =~ "built" ]]
+    grep -qx "rm -f abc123def4567890" "$FAKE_DOCKER_LOG"
+    grep -q "^run --rm -it -e FOO=bar ubuntu:24.04 bash -lc" "$FAKE_DOCKER_LOG"
+}
+
+@test "The container is removed when the run is interrupted" {
+    set -m
+    bash "$SHELL_BUN" --ci App slow "$TEST_CONFIG" > "$BATS_TEST_TMPDIR/out" 2>&1 &
+    local pid=$!
+    set +m
+    sleep 1
+    kill -TERM "$pid"
+    wait "$pid" || true
+    grep -qx "rm -f abc123def4567890" "$FAKE_DOCKER_LOG"
+}
+
+@test "Container commands that are not '<runtime> run' keep per-action mode" {
+    sed -i 's/^container=.*/container=docker exec builder/' "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --ci App test "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "container_persistent needs a '<runtime> run ...' container command or container_start" ]]
+    [[ "$output" =~ "tested" ]]
+}
+
+@test "container_persistent without a container is reported" {
+    sed -i '/^container=/d' "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --validate "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "container_persistent is set but no container is configured" ]]
+}
@@ -0,0 +1,86 @@
+#!/usr/bin/env bats
+
+# Test container profiles: named container commands (container.NAME) that apps
+# select with container=NAME, or container=none to run on the host
+
+load helpers/terminal
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    export SHELL_BUN_CONTAINER_MARKER_FILE="$BATS_TEST_TMPDIR/containerenv"
+    export LOG_DIR="$BATS_TEST_TMPDIR/logs"
+    TEST_CONFIG="$BATS_TEST_TMPDIR/profiles.cfg"
+    cat > "$TEST_CONFIG" << EOF2
+log_dir=$LOG_DIR
+container=env WHERE=default
+container.node=env WHERE=node
+container.py=env WHERE=py
+
+[Frontend]
+container=node
+build=echo "frontend in \${WHERE:-host}"
+
+[Backend]
+container = py
+build=echo "backend in \${WHERE:-host}"
+
+[Tools]
+container=none
+build=echo "tools in \${WHERE:-host}"
+
+[Docs]
+build=echo "docs in \${WHERE:-host}"
+EOF2
+}
+
+@test "Container profiles: each app runs in the container it selects" {
+    run bash "$SHELL_BUN" --no-trust-check --ci "*" build --sequential "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Container profiles: node, py" ]]
+    [[ "$output" =~ "frontend in node" ]]
+    [[ "$output" =~ "backend in py" ]]
+    [[ "$output" =~ "tools in host" ]]
+    [[ "$output" =~ "docs in default" ]]
+
+    run bash "$SHELL_BUN" --no-trust-check --ci "*" build --dry-run --sequential "$TEST_CONFIG"
+    [[ "$output" =~ "[dry-run] env WHERE=node bash -lc echo" ]]
+    [[ "$output" =~ "[dry-run] env WHERE=py bash -lc echo" ]]
+    [[ "$output" =~ "[dry-run] cd '$SCRIPT_DIR' && bash -c echo\\ \\\"tools" ]]
+}
+
+@test "Container profiles: --container and a container marker replace them all" {
+    run bash "$SHELL_BUN" --no-trust-check --container "env WHERE=cli" --ci "*" build --sequential "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "frontend in cli" ]]
+    [[ "$output" =~ "tools in cli" ]]
+
+    : > "$SHELL_BUN_CONTAINER_MARKER_FILE"
+    run bash "$SHELL_BUN" --no-trust-check --ci "*" build --sequential "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "ignoring container profiles: node, py" ]]
+    [[ "$output" =~ "frontend in host" ]]
+    [[ "$output" =~ "docs in host" ]]
+}
+
+@test "Container profiles: an unknown profile is an error with its line" {
+    sed -i 's/^container = py$/container = python/' "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --no-trust-check --list "*" "$TEST_CONFIG"
+    [ "$status" -eq 2 ]
+    [[ "$output" =~ "Error: [Backend] container: no container profile named 'python' ($TEST_CONFIG:11)" ]]
+    [[ "$output" =~ "container.python=COMMAND" ]]
+
+    sed -i -e 's/^container = python$/container = py/' -e '4a container.none=env WHERE=nowhere' "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --no-trust-check --validate "$TEST_CONFIG"
+    [[ "$output" =~ "Ignoring container.none: 'none' is not a valid container profile name ($TEST_CONFIG:5)" ]]
+}
+
+@test "Container profiles: Show Details names the profile" {
+    require_terminal
+    run_terminal "$TEST_CONFIG" -- f r o n t e n d space d e t a i l s enter wait:1 enter esc
+    [[ "$(plain_output)" =~ "Container:      env WHERE=node (profile node)" ]]
+    run_terminal --fresh "$TEST_CONFIG" -- t o o l s space d e t a i l s enter wait:1 enter esc
+    [[ "$(plain_output)" =~ "Container:      (none - runs on host, container=none)" ]]
+}
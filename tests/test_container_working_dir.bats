@@ -1,6 +1,8 @@
 #!/usr/bin/env bats
 
 setup() {
+    load helpers/common
+    common_setup
     export TEST_DIR="$BATS_TEST_DIRNAME"
     export SCRIPT_DIR="$(cd "$TEST_DIR/.." && pwd)"
     export TEST_CONFIG="$TEST_DIR/fixtures/container_working_dir.cfg"
@@ -0,0 +1,69 @@
+#!/usr/bin/env bats
+
+# Test terminal restoration and crash reporting of the interactive UI
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_FIXTURES="$SCRIPT_DIR/tests/fixtures"
+    CRASH_REPORT="$BATS_TEST_TMPDIR/crash.txt"
+
+    # The interactive UI needs a terminal; util-linux 'script' provides one
+    if ! script -qec true /dev/null >/dev/null 2>&1; then
+        skip "util-linux 'script' is required to emulate a terminal"
+    fi
+}
+
+teardown() {
+    rm -rf "$SCRIPT_DIR/test_logs"
+}
+
+run_in_terminal() {
+    run bash -c "sleep 1 | script -qec \"$1\" /dev/null"
+}
+
+# Write a copy of shell-bun.sh to CRASHING_SHELL_BUN whose menu fails reading a key,
+# like an unexpected bug inside the UI would
+write_crashing_shell_bun() {
+    CRASHING_SHELL_BUN="$BATS_TEST_TMPDIR/shell-bun.sh"
+    sed 's/^main "\$@"/read_ui_key() { : "${__shell_bun_simulated_crash}"; }\n&/' "$SHELL_BUN" > "$CRASHING_SHELL_BUN"
+    grep -q '^read_ui_key() { : ' "$CRASHING_SHELL_BUN"
+}
+
+@test "Simulated crash restores the terminal and exits non-zero" {
+    write_crashing_shell_bun
+    run_in_terminal "bash '$CRASHING_SHELL_BUN' '$TEST_FIXTURES/basic.cfg'"
+    [ "$status" -ne 0 ]
+    # Cursor shown again after the UI hid it
+    [[ "$output" == *$'\033[?25l'*$'\033[?25h'* ]]
+    [[ "$output" =~ "crashed unexpectedly" ]]
+    [[ "$output" =~ "unbound variable" ]]
+    [[ "$output" =~ "Last run logs:" ]]
+    [[ "$output" =~ "--crash-report" ]]
+}
+
+@test "Crash report is written with --crash-report" {
+    write_crashing_shell_bun
+    run_in_terminal "bash '$CRASHING_SHELL_BUN' --crash-report '$CRASH_REPORT' '$TEST_FIXTURES/basic.cfg'"
+    [ "$status" -ne 0 ]
+    [[ -f "$CRASH_REPORT" ]]
+    grep -q "crashed unexpectedly" "$CRASH_REPORT"
+    grep -q "View:.*menu" "$CRASH_REPORT"
+    grep -q "Config:.*basic.cfg" "$CRASH_REPORT"
+}
+
+@test "Clean quit restores the terminal without a crash report" {
+    run bash -c "(sleep 1; printf '\033'; sleep 0.5) | script -qec \"bash '$SHELL_BUN' --crash-report '$CRASH_REPORT' '$TEST_FIXTURES/basic.cfg'\" /dev/null"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Goodbye!" ]]
+    [[ "$output" == *$'\033[?25h'* ]]
+    [[ ! -f "$CRASH_REPORT" ]]
+}
+
+@test "--crash-report requires a path" {
+    run bash "$SHELL_BUN" --crash-report
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "--crash-report requires a file path" ]]
+}
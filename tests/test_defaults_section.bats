@@ -0,0 +1,57 @@
+#!/usr/bin/env bats
+
+# Test the [defaults] section and the global working_dir it can hold
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    PROJECT="$BATS_TEST_TMPDIR/project"
+    TEST_CONFIG="$PROJECT/shell-bun.cfg"
+    mkdir -p "$PROJECT/src" "$PROJECT/api"
+
+    cat > "$TEST_CONFIG" << 'EOF'
+[defaults]
+working_dir=${CONFIG_DIR}/src
+shell=sh
+timeout=5m
+env.MODE=default
+
+[Web]
+build=echo "web in $PWD, MODE=$MODE, shell $0"
+
+[Api]
+working_dir=${CONFIG_DIR}/api
+env.MODE=api
+build=echo "api in $PWD, MODE=$MODE"
+build.timeout=1s
+slow=sleep 3
+EOF
+}
+
+@test "[defaults] settings apply to every app that does not set its own" {
+    run bash "$SHELL_BUN" --ci "*" build --sequential --no-trust-check "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "web in $PROJECT/src, MODE=default, shell sh" ]]
+    [[ "$output" =~ "api in $PROJECT/api, MODE=api" ]]
+
+    # The action's own timeout wins over the default one
+    run bash "$SHELL_BUN" --ci Api slow --no-trust-check "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    sed -i 's/^build.timeout=1s$/slow.timeout=1s/' "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --ci Api slow --no-trust-check "$TEST_CONFIG"
+    [ "$status" -ne 0 ]
+    [[ "$output" =~ "Timed out: Api - slow" ]]
+}
+
+@test "A missing default working_dir is reported at its line and the section is not an app" {
+    sed -i 's|^working_dir=${CONFIG_DIR}/src$|working_dir=${CONFIG_DIR}/missing|' "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --validate --no-trust-check "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "[Web] working_dir: $PROJECT/missing does not exist ($TEST_CONFIG:2)" ]]
+    [[ ! "$output" =~ "[Api] working_dir: $PROJECT/missing" ]]
+
+    run bash -c "bash '$SHELL_BUN' --list --no-trust-check '$TEST_CONFIG' 2>/dev/null"
+    [ "$output" == "Web"$'\n'"Api" ]
+}
@@ -0,0 +1,204 @@
+#!/usr/bin/env bats
+
+# Test actions of a batch that need others to succeed first (ACTION.depends_on and ACTION.depends)
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_CONFIG="$BATS_TEST_TMPDIR/depends.cfg"
+
+    echo "log_dir=$BATS_TEST_TMPDIR/logs" > "$TEST_CONFIG"
+    cat >> "$TEST_CONFIG" << 'EOF'
+
+[App]
+build=sleep 1; echo "build done"
+broken=echo "broken build"; exit 1
+flash=echo "flashing"
+flash.depends_on=build
+verify=echo "verifying"
+verify.depends_on=flash
+lint=echo "linting"
+EOF
+}
+
+# Print the line number of the first output line containing the text
+line_of() {
+    echo "$output" | grep -n -F "$1" | head -1 | cut -d: -f1
+}
+
+@test "An action starts once the actions it depends on succeeded" {
+    run bash "$SHELL_BUN" --ci App "build,flash,lint" "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [ "$(line_of "Completed: App - build")" -lt "$(line_of "Starting: App - flash")" ]
+    [ "$(line_of "Starting: App - lint")" -lt "$(line_of "Completed: App - build")" ]
+}
+
+@test "Dependents of a failed action are skipped, also further down the chain" {
+    sed -i 's/^flash.depends_on=build$/flash.depends_on=broken/' "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --ci App "broken,flash,verify,lint" "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "Skipped: App - flash (broken did not succeed)" ]]
+    [[ "$output" =~ "Skipped: App - verify (flash did not succeed)" ]]
+    [[ ! "$output" =~ "flashing" ]]
+    [[ "$output" =~ "Commands executed: 2" ]]
+    [[ "$output" =~ "Skipped operations: 2"$'\n'"  - App - flash (broken did not succeed)"$'\n'"  - App - verify (flash did not succeed)" ]]
+}
+
+@test "Skipped actions are reported as skipped in JUnit" {
+    sed -i 's/^flash.depends_on=build$/flash.depends_on=broken/' "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --ci App "broken,flash" --output junit "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ '<skipped message="skipped: depends on broken, which did not succeed"/>' ]]
+}
+
+@test "depends_on adds the actions of the same app an action needs to its batch" {
+    run bash "$SHELL_BUN" --ci App flash "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Added as dependencies: App - build" ]]
+    [ "$(line_of "Completed: App - build")" -lt "$(line_of "Starting: App - flash")" ]
+    [[ "$output" =~ "Commands executed: 2" ]]
+}
+
+@test "Dependency cycles stop the config from loading, naming the actions" {
+    echo "lint.depends_on=missing" >> "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --validate "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "[App] lint.depends_on: no action named 'missing'" ]]
+
+    echo "build.depends_on=verify" >> "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --validate "$TEST_CONFIG"
+    [ "$status" -eq 2 ]
+    [[ "$output" =~ "Error: [App] depends_on: dependency cycle between build, flash, verify ($TEST_CONFIG:12)" ]]
+
+    run bash "$SHELL_BUN" --ci App lint "$TEST_CONFIG"
+    [ "$status" -eq 2 ]
+    [[ "$output" =~ "Error: [App] depends_on: dependency cycle between build, flash, verify" ]]
+    [[ ! "$output" =~ "linting" ]]
+}
+
+@test "Dependency cycles through other apps are errors too" {
+    cat >> "$TEST_CONFIG" << 'EOF'
+
+[Lib]
+build=echo "lib build"
+build.depends_on=App:verify
+EOF
+    sed -i 's/^flash.depends_on=build$/flash.depends_on=Lib:build/' "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --ci App lint "$TEST_CONFIG"
+    [ "$status" -eq 2 ]
+    [[ "$output" =~ "Error: depends_on: dependency cycle between App - flash, App - verify, Lib - build ($TEST_CONFIG:7)" ]]
+}
+
+@test "The menu does not start with a dependency cycle" {
+    if ! script -qec true /dev/null >/dev/null 2>&1; then
+        skip "util-linux 'script' is required to emulate a terminal"
+    fi
+    echo "build.depends_on=verify" >> "$TEST_CONFIG"
+    run bash -c "(sleep 1; printf '\033'; sleep 0.3) | script -qec \"stty cols 200; bash '$SHELL_BUN' '$TEST_CONFIG'; echo exit=\\\$?\" /dev/null"
+    [[ "$output" =~ "Error: [App] depends_on: dependency cycle between build, flash, verify" ]]
+    [[ "$output" =~ "exit=2" ]]
+    [[ ! "$output" =~ "Goodbye!" ]]
+}
+
+@test "The menu summary and log show why an action was skipped" {
+    if ! script -qec true /dev/null >/dev/null 2>&1; then
+        skip "util-linux 'script' is required to emulate a terminal"
+    fi
+    cat > "$TEST_CONFIG" << EOF
+log_dir=$BATS_TEST_TMPDIR/logs
+
+[App]
+build=sleep 1; exit 2
+flash=echo "flashing"
+flash.depends_on=build
+EOF
+    run bash -c "(sleep 1; printf '+'; sleep 0.3; printf '\r'; sleep 3; printf 'q'; sleep 0.5; printf '\033'; sleep 0.3) | script -qec \"stty cols 200; bash '$SHELL_BUN' '$TEST_CONFIG'\" /dev/null"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "App - flash  [skipped]" ]]
+    [[ "$output" =~ "Skipped: 1" ]]
+    [[ "$output" =~ "App flash (skipped, build did not succeed)" ]]
+    run cat "$BATS_TEST_TMPDIR"/logs/*_App_flash.log
+    [[ "$output" =~ "[shell-bun] Action skipped: it depends on build, which did not succeed" ]]
+}
+
+@test "depends adds the actions an action needs to its batch, ahead of it" {
+    cat >> "$TEST_CONFIG" << 'EOF'
+package=echo "packaging"
+package.depends=verify, lint
+EOF
+    sed -i 's/^verify.depends_on=flash$/verify.depends=flash/; s/^flash.depends_on=build$/flash.depends=build/' "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --ci App package "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Added as dependencies: App - build, App - flash, App - verify, App - lint" ]]
+    [ "$(line_of "Completed: App - build")" -lt "$(line_of "Starting: App - flash")" ]
+    [ "$(line_of "Completed: App - verify")" -lt "$(line_of "Starting: App - package")" ]
+    [[ "$output" =~ "Commands executed: 5" ]]
+
+    run bash "$SHELL_BUN" --ci App package --explain "$TEST_CONFIG"
+    [[ "$output" =~ "Execution plan for 5 action(s):" ]]
+    [[ "$output" =~ "Wave 1: App - build, App - lint"$'\n'"Wave 2: App - flash"$'\n'"Wave 3: App - verify"$'\n'"Wave 4: App - package" ]]
+}
+
+@test "Actions added by depends must succeed and their cycles are errors" {
+    sed -i 's/^flash.depends_on=build$/flash.depends=broken/' "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --ci App flash "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "Skipped: App - flash (broken did not succeed)" ]]
+
+    echo "broken.depends=flash" >> "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --validate "$TEST_CONFIG"
+    [ "$status" -eq 2 ]
+    [[ "$output" =~ "Error: [App] depends: dependency cycle between broken, flash ($TEST_CONFIG:11)" ]]
+}
+
+@test "App:action depends on an action of another app" {
+    cat >> "$TEST_CONFIG" << 'EOF'
+
+[Shared Lib]
+clean=echo "lib clean"
+build=echo "lib build"; exit 1
+
+[Tool]
+package=echo "packaging"
+package.depends = Shared Lib:clean, App : lint
+release=echo "releasing"
+release.depends_on=Shared Lib:build, Nope:x
+EOF
+    run bash "$SHELL_BUN" --ci Tool package "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Added as dependencies: Shared Lib - clean, App - lint" ]]
+    [ "$(line_of "Completed: Shared Lib - clean")" -lt "$(line_of "Starting: Tool - package")" ]
+    [[ "$output" =~ "[Tool] release.depends_on: no action 'x' in [Nope] ($TEST_CONFIG:20)" ]]
+
+    run bash "$SHELL_BUN" --ci "Shared*,Tool" "build,release" "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "Skipped: Tool - release (Shared Lib - build did not succeed)" ]]
+
+    # depends_on adds an action of another app to the batch like depends
+    run bash "$SHELL_BUN" --ci Tool release "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "Added as dependencies: Shared Lib - build" ]]
+    [[ "$output" =~ "Skipped: Tool - release (Shared Lib - build did not succeed)" ]]
+    [[ ! "$output" =~ "releasing" ]]
+}
+
+@test "Running one action from the menu also runs the actions it depends on" {
+    if ! script -qec true /dev/null >/dev/null 2>&1; then
+        skip "util-linux 'script' is required to emulate a terminal"
+    fi
+    cat > "$TEST_CONFIG" << EOF
+log_dir=$BATS_TEST_TMPDIR/logs
+
+[App]
+flash=echo "flashing"
+flash.depends=build
+build=echo "building"
+EOF
+    run bash -c "(sleep 1; printf '\r'; sleep 3; printf 'q'; sleep 0.5; printf '\033'; sleep 0.3) | script -qec \"stty cols 200; bash '$SHELL_BUN' '$TEST_CONFIG'\" /dev/null"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Executing 2 selected items in parallel" ]]
+    [[ "$output" =~ "SUCCESS: App - build" ]]
+    [[ "$output" =~ "SUCCESS: App - flash" ]]
+}
@@ -0,0 +1,67 @@
+#!/usr/bin/env bats
+
+# Test dry runs (--dry-run) that print the resolved commands instead of running them
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_CONFIG="$BATS_TEST_TMPDIR/dry.cfg"
+    MARKER="$BATS_TEST_TMPDIR/marker"
+    LOG_DIR="$BATS_TEST_TMPDIR/logs"
+    # Keep the configured container active even when the tests run inside a container
+    export SHELL_BUN_CONTAINER_MARKER_FILE="$BATS_TEST_TMPDIR/no-containerenv"
+
+    cat > "$TEST_CONFIG" << EOF
+log_dir=$LOG_DIR
+env_STAGE=ci
+
+[Web]
+working_dir=$BATS_TEST_TMPDIR
+build=echo built > "$MARKER"
+test=exit 3
+run=./run.sh {{args...}}
+EOF
+}
+
+@test "--dry-run prints the resolved command of each action without running it" {
+    run bash "$SHELL_BUN" --ci Web build,test --dry-run "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [ ! -e "$MARKER" ]
+    [[ "$output" =~ "Fuzzy Pattern Execution (Parallel, dry-run)" ]]
+    [[ "$output" == *"[dry-run] cd '$BATS_TEST_TMPDIR' && bash -c export\\ STAGE=\\'ci\\'\\;\\ echo\\ built"* ]]
+    [[ "$output" =~ "[dry-run] cd '$BATS_TEST_TMPDIR' && bash -c export\\ STAGE=\\'ci\\'\\;\\ exit\\ 3" ]]
+    [[ "$output" =~ "CI Execution Summary (Parallel, dry-run):" ]]
+    [[ "$output" =~ "Successful operations: 2" ]]
+}
+
+@test "--dry-run fills in forwarded arguments" {
+    run bash "$SHELL_BUN" "$TEST_CONFIG" --ci Web run --dry-run -- --fast "two words"
+    [ "$status" -eq 0 ]
+    [[ "$output" == *'./run.sh\ --fast\ two\\\ words'* ]]
+}
+
+@test "--dry-run shows the container wrapping" {
+    sed -i '1i container=docker run --rm builder' "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --ci Web build --dry-run "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "[dry-run] docker run --rm builder bash -lc cd\\ " ]]
+    [[ ! "$output" =~ "[dry-run] cd " ]]
+}
+
+@test "Interactive dry runs log the command and label the results" {
+    if ! script -qec true /dev/null >/dev/null 2>&1; then
+        skip "util-linux 'script' is required to emulate a terminal"
+    fi
+    # Without the action that prompts for arguments
+    sed -i '/^run=/d' "$TEST_CONFIG"
+    run bash -c "(sleep 1; printf '+'; sleep 0.3; printf '\r'; sleep 1.5; printf 'q'; sleep 0.3; printf '\033'; sleep 0.3) | script -qec \"stty cols 200; bash '$SHELL_BUN' --dry-run '$TEST_CONFIG'\" /dev/null"
+    [ "$status" -eq 0 ]
+    [ ! -e "$MARKER" ]
+    [[ "$output" =~ "Dry run: commands are shown, not run" ]]
+    [[ "$output" =~ "Execution Summary (dry-run):" ]]
+    [[ "$output" =~ "Web test "[0-9]+"ms (dry-run)" ]]
+    grep -q "^\[dry-run\] cd '$BATS_TEST_TMPDIR' && bash -c " "$LOG_DIR"/*_Web_build.log
+    grep -q '^\[shell-bun\] Finished with exit code 0 ' "$LOG_DIR"/*_Web_test.log
+}
@@ -0,0 +1,68 @@
+#!/usr/bin/env bats
+
+# Test how long actions ran: durations under a second in milliseconds, the batch's
+# total time and sorting the log viewer by duration
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_CONFIG="$BATS_TEST_TMPDIR/durations.cfg"
+    LOG_DIR="$BATS_TEST_TMPDIR/logs"
+
+    cat > "$TEST_CONFIG" << EOF
+log_dir=$LOG_DIR
+
+[Quick]
+build=true
+
+[Slow]
+build=sleep 1.2
+EOF
+}
+
+@test "CI completion lines show durations under a second in milliseconds" {
+    run bash "$SHELL_BUN" --ci Quick build --no-trust-check "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Completed: Quick - build ("[0-9]+"ms)" ]]
+}
+
+@test "CI completion lines show longer durations in seconds" {
+    run bash "$SHELL_BUN" --ci Slow build --no-trust-check "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Completed: Slow - build ("[0-9]+"s)" ]]
+}
+
+@test "The CI summary shows the total time of the run" {
+    run bash "$SHELL_BUN" --ci "*" build --no-trust-check "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Total time: "[0-9]+"s" ]]
+}
+
+@test "Interactive batches show the total time and log the duration of each action" {
+    if ! script -qec true /dev/null >/dev/null 2>&1; then
+        skip "util-linux 'script' is required to emulate a terminal"
+    fi
+    run bash -c "(sleep 1; printf '+'; sleep 0.3; printf '\r'; sleep 3; printf 'q'; sleep 0.3; printf '\033'; sleep 0.3) | script -qec \"stty cols 200 rows 30; bash '$SHELL_BUN' --no-trust-check '$TEST_CONFIG'\" /dev/null"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Total time: "[0-9]+"s" ]]
+    [[ "$output" =~ "Quick build "[0-9]+"ms" ]]
+    grep -qE '^\[shell-bun\] Finished with exit code 0 after [0-9]+ms at ' "$LOG_DIR"/*_Quick_build.log
+    grep -qE '^\[shell-bun\] Finished with exit code 0 after 1s at ' "$LOG_DIR"/*_Slow_build.log
+}
+
+@test "d in the log viewer sorts the actions by duration, longest first" {
+    if ! script -qec true /dev/null >/dev/null 2>&1; then
+        skip "util-linux 'script' is required to emulate a terminal"
+    fi
+    run bash -c "(sleep 1; printf '+'; sleep 0.3; printf '\r'; sleep 3; printf 'd'; sleep 0.5; printf 'q'; sleep 0.3; printf '\033'; sleep 0.3) | script -qec \"stty cols 200 rows 30; bash '$SHELL_BUN' --no-trust-check '$TEST_CONFIG'\" /dev/null"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "d to sort by duration" ]]
+    [[ "$output" =~ "Sorted by duration, longest first" ]]
+    # Before the key Quick comes first, in config order; after it Slow is listed above Quick
+    local before="${output%%Sorted by duration*}"
+    local unsorted="${before%%SUCCESS: Slow - build*}"
+    [[ "$unsorted" =~ "SUCCESS: Quick - build" ]]
+    [[ ! "${before##*SUCCESS: Quick - build}" =~ "SUCCESS: Slow - build" ]]
+}
@@ -0,0 +1,82 @@
+#!/usr/bin/env bats
+
+# Test jumping to an action's definition in $EDITOR and reloading the config
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_CONFIG="$BATS_TEST_TMPDIR/edit.cfg"
+
+    # The interactive UI needs a terminal; util-linux 'script' provides one
+    if ! script -qec true /dev/null >/dev/null 2>&1; then
+        skip "util-linux 'script' is required to emulate a terminal"
+    fi
+
+    cat > "$TEST_CONFIG" << EOF
+log_dir=$BATS_TEST_TMPDIR/logs
+
+[App]
+build=echo "building"
+test=echo "testing"
+EOF
+
+    # Records its arguments and adds an action, like a user editing the file
+    export EDITOR="$BATS_TEST_TMPDIR/editor"
+    cat > "$EDITOR" << EOF
+#!/bin/bash
+echo "\$@" > "$BATS_TEST_TMPDIR/editor.args"
+echo 'extra=echo "added"' >> "\${@: -1}"
+EOF
+    chmod +x "$EDITOR"
+    unset VISUAL
+}
+
+# Type a filter, press '@', then feed each further argument as a group of keys
+edit_and_press() {
+    local filter="$1"
+    shift
+    local keys="" group
+    for group in "$@"; do
+        keys="$keys printf '$group'; sleep 1;"
+    done
+    run bash -c "(sleep 1; printf '$filter'; sleep 0.3; printf '@'; sleep 1.5; $keys printf '\033'; sleep 0.3) | script -qec \"stty cols 200; bash '$SHELL_BUN' --no-trust-check '$TEST_CONFIG'\" /dev/null"
+}
+
+@test "'@' opens the editor at the line defining the highlighted action" {
+    edit_and_press "test"
+    [ "$status" -eq 0 ]
+    [ "$(cat "$BATS_TEST_TMPDIR/editor.args")" = "+5 $TEST_CONFIG" ]
+}
+
+@test "'@' on Show Details opens the editor at the app's section" {
+    edit_and_press "details"
+    [ "$(cat "$BATS_TEST_TMPDIR/editor.args")" = "+3 $TEST_CONFIG" ]
+}
+
+@test "The config is reloaded when the editor exits, keeping the filter" {
+    edit_and_press "test" "\\033[3~extra\\r" "\\r"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Filter: test" ]]
+    [[ "$output" =~ "Executing: App - extra" ]]
+    [[ "$output" =~ "added" ]]
+}
+
+@test "A config that no longer loads keeps the previous one" {
+    cat > "$EDITOR" << 'EOF'
+#!/bin/bash
+echo "log_dir=logs" > "${@: -1}"
+EOF
+    edit_and_press "build" "\\r" "\\r" "\\r"
+    [[ "$output" =~ "The edited configuration could not be loaded; keeping the previous one" ]]
+    [[ "$output" =~ "No applications found in configuration file!" ]]
+    [[ "$output" =~ "Executing: App - build" ]]
+}
+
+@test "Show Details lists where each action is defined" {
+    run bash -c "(sleep 1; printf 'details'; sleep 0.3; printf '\\r'; sleep 0.5; printf '\\r'; sleep 0.5; printf '\033'; sleep 0.3) | script -qec \"stty cols 200; bash '$SHELL_BUN' --no-trust-check '$TEST_CONFIG'\" /dev/null"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Defined at: $TEST_CONFIG:4" ]]
+    [[ "$output" =~ "Defined at: $TEST_CONFIG:5" ]]
+}
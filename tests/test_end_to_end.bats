@@ -0,0 +1,81 @@
+#!/usr/bin/env bats
+
+# End-to-end scenarios: the menu, running view and log viewer driven by keys in an
+# emulated terminal, with real commands, checked by what is drawn and logged
+
+load helpers/terminal
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_CONFIG="$BATS_TEST_TMPDIR/e2e.cfg"
+    LOG_DIR="$BATS_TEST_TMPDIR/logs"
+
+    cat > "$TEST_CONFIG" << EOF
+log_dir=$LOG_DIR
+
+[Web]
+build=echo "web built"
+test=echo "web tests"; exit 3
+
+[Api]
+build=echo "api built"
+hang=sleep 30
+EOF
+}
+
+@test "Filtering the menu and running the highlighted action" {
+    require_terminal
+    run_terminal "$TEST_CONFIG" -- a p i enter wait:1 enter esc
+    [ "$status" -eq 0 ]
+    [[ "$(plain_output)" =~ "Filter: api" ]]
+    [[ "$(plain_output)" =~ "Completed: Api - build" ]]
+    [[ "$(last_frame)" =~ "Goodbye!" ]]
+    assert_log_matches Api build '^api built$'
+    assert_log_matches Api build '^\[shell-bun\] Finished with exit code 0 '
+    [ -z "$(ls "$LOG_DIR" | grep _Web_)" ]
+}
+
+@test "A batch lists failures first in the log viewer, which opens their logs" {
+    require_terminal
+    run_terminal "$TEST_CONFIG" -- w e b + enter wait:2 enter wait:1 q q esc
+    [ "$status" -eq 0 ]
+    local viewer
+    viewer=$(plain_output | grep -a -A2 '^  BATCH: ' | head -3)
+    [[ "$(echo "$viewer" | sed -n 2p)" =~ "FAILED: Web - test" ]]
+    [[ "$(echo "$viewer" | sed -n 3p)" =~ "SUCCESS: Web - build" ]]
+    [[ "$(plain_output)" =~ "Phases: " ]]
+    # Enter on the failed row shows its log, footer included
+    [[ "$(plain_output)" =~ "Finished with exit code 3 after" ]]
+    assert_log_matches Web test '^web tests$'
+}
+
+@test "Cancelling an action from the running view" {
+    require_terminal
+    run_terminal "$TEST_CONFIG" -- h a n g space enter wait:1.5 x wait:1.5 q esc
+    [ "$status" -eq 0 ]
+    [[ "$(plain_output)" =~ "Cancelled Api - hang" ]]
+    [[ "$(plain_output)" =~ "CANCELLED: Api - hang" ]]
+    assert_log_matches Api hang '^\[shell-bun\] Action cancelled from the running view '
+}
+
+@test "Moving through the log viewer and returning to the menu" {
+    require_terminal
+    run_terminal "$TEST_CONFIG" -- w e b + enter wait:2 down down up q esc
+    [ "$status" -eq 0 ]
+    # q returns to the menu, with the batch still selected
+    local menu="${output##*BATCH: }"
+    [[ "$(plain_output "$menu")" =~ "Selected: 2 items" ]]
+    [[ "$(plain_output "$menu")" =~ "► Web - build [✓]" ]]
+}
+
+@test "CI runs report their exit code and output" {
+    run bash "$SHELL_BUN" --ci Web "*" --no-trust-check "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "Completed: Web - build" ]]
+    [[ "$output" =~ "Failed: Web - test" ]]
+    [[ "$output" =~ "web tests" ]]
+    [ ! -e "$LOG_DIR" ]
+}
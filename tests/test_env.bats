@@ -0,0 +1,106 @@
+#!/usr/bin/env bats
+
+# Test environment variables set for actions with env_NAME (or env.NAME) and ACTION.env.NAME keys
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_CONFIG="$BATS_TEST_TMPDIR/env.cfg"
+    # Keep the configured container active even when the tests run inside a container
+    export SHELL_BUN_CONTAINER_MARKER_FILE="$BATS_TEST_TMPDIR/no-containerenv"
+
+    cat > "$TEST_CONFIG" << 'EOF'
+env_GOFLAGS = -trimpath
+env_STAGE=global
+
+[Plain]
+show=echo "Plain: GOFLAGS=$GOFLAGS STAGE=$STAGE ONLY=${ONLY:-unset}"
+
+[Custom]
+env_STAGE=it's $HOME
+env_ONLY=custom
+show=echo "Custom: GOFLAGS=$GOFLAGS STAGE=$STAGE ONLY=${ONLY:-unset}"
+EOF
+}
+
+@test "Global env_ variables are inherited by every app" {
+    run bash "$SHELL_BUN" --ci Plain show "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Plain: GOFLAGS=-trimpath STAGE=global ONLY=unset" ]]
+}
+
+@test "App env_ variables override global ones and are taken literally" {
+    run bash "$SHELL_BUN" --ci Custom show "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" == *'Custom: GOFLAGS=-trimpath STAGE=it'\''s $HOME ONLY=custom'* ]]
+}
+
+@test "App env_ variables do not leak into other apps" {
+    run bash "$SHELL_BUN" --ci Plain,Custom show "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Plain: GOFLAGS=-trimpath STAGE=global ONLY=unset" ]]
+    [[ "$output" =~ "Custom: GOFLAGS=-trimpath STAGE=it's" ]]
+}
+
+@test "Invalid env_ names are reported and ignored" {
+    printf 'env_1BAD=x\n' | cat - "$TEST_CONFIG" > "$BATS_TEST_TMPDIR/bad.cfg"
+    run bash "$SHELL_BUN" --ci Plain show "$BATS_TEST_TMPDIR/bad.cfg"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Ignoring env_1BAD: '1BAD' is not a valid environment variable name" ]]
+}
+
+@test "env_ variables are set inside the container" {
+    # Simulate a container that starts with an empty environment
+    printf 'container=env -i PATH=/usr/bin:/bin\n' | cat - "$TEST_CONFIG" > "$BATS_TEST_TMPDIR/container.cfg"
+    run bash "$SHELL_BUN" --ci Custom show "$BATS_TEST_TMPDIR/container.cfg"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Custom: GOFLAGS=-trimpath STAGE=it's" ]]
+}
+
+@test "Exported scripts set the app's env_ variables" {
+    bash "$SHELL_BUN" --export-script Custom "$TEST_CONFIG" > "$BATS_TEST_TMPDIR/custom.sh" 2>/dev/null
+    grep -q "^    export STAGE='it'\\\\''s \$HOME'$" "$BATS_TEST_TMPDIR/custom.sh"
+    run bash "$BATS_TEST_TMPDIR/custom.sh" show
+    [ "$status" -eq 0 ]
+    [[ "$output" == *'Custom: GOFLAGS=-trimpath STAGE=it'\''s $HOME ONLY=custom'* ]]
+}
+
+@test "env_ values expand braced variables set before them or in the environment" {
+    cat > "$BATS_TEST_TMPDIR/expand.cfg" << 'EOF2'
+env_SDKROOT=${SHELL_BUN_TEST_BASE}/sdk
+env_TOOLS={{config_dir}}/tools
+
+[App]
+env_SDKBIN=${SDKROOT}/bin
+env_KEPT=$${SDKROOT} ${SHELL_BUN_TEST_UNSET}end
+show=echo "SDKROOT=$SDKROOT TOOLS=$TOOLS SDKBIN=$SDKBIN KEPT=$KEPT"
+EOF2
+    SHELL_BUN_TEST_BASE=/opt/base run bash "$SHELL_BUN" --ci App show "$BATS_TEST_TMPDIR/expand.cfg"
+    [ "$status" -eq 0 ]
+    [[ "$output" == *'SDKROOT=/opt/base/sdk TOOLS='"$BATS_TEST_TMPDIR"'/tools SDKBIN=/opt/base/sdk/bin KEPT=${SDKROOT} end'* ]]
+}
+
+@test "ACTION.env.NAME variables override the app's for that action only" {
+    cat > "$BATS_TEST_TMPDIR/action.cfg" << 'EOF2'
+env.STAGE=global
+
+[App]
+env.ONLY=app
+show=echo "show: STAGE=$STAGE ONLY=$ONLY EXTRA=${EXTRA:-unset}"
+show.env.STAGE=action
+show.env.EXTRA=${STAGE}-extra
+other=echo "other: STAGE=$STAGE ONLY=$ONLY EXTRA=${EXTRA:-unset}"
+missing.env.X=1
+EOF2
+    run bash "$SHELL_BUN" --ci App all --sequential "$BATS_TEST_TMPDIR/action.cfg"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "show: STAGE=action ONLY=app EXTRA=action-extra" ]]
+    [[ "$output" =~ "other: STAGE=global ONLY=app EXTRA=unset" ]]
+    [[ "$output" =~ "[App] missing.env.X: no action named 'missing' ($BATS_TEST_TMPDIR/action.cfg:9)" ]]
+
+    bash "$SHELL_BUN" --export-script App "$BATS_TEST_TMPDIR/action.cfg" > "$BATS_TEST_TMPDIR/app.sh" 2>/dev/null
+    run bash "$BATS_TEST_TMPDIR/app.sh" show
+    [[ "$output" =~ "show: STAGE=action ONLY=app EXTRA=action-extra" ]]
+}
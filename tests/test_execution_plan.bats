@@ -0,0 +1,80 @@
+#!/usr/bin/env bats
+
+# Test the execution plan (waves of the dependency graph) and --explain
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_FIXTURES="$SCRIPT_DIR/tests/fixtures"
+
+    # Load just the planner; sourcing the whole script would start the UI
+    eval "$(sed -n '/^# Function to layer a batch of actions/,/^# Function to show the execution plan/p' "$SHELL_BUN")"
+    print_color() { echo "$2"; }
+    declare -gA ACTION_DEPENDENCIES=()
+    declare -gA ACTION_AFTER=()
+}
+
+@test "Plan: actions without dependencies share the first wave" {
+    run print_execution_plan "A:build" "B:build"
+    [ "$status" -eq 0 ]
+    [ "$output" = "Wave 1: A - build, B - build" ]
+}
+
+@test "Plan: diamond-shaped dependencies are layered into three waves" {
+    ACTION_DEPENDENCIES["B:build"]="A:build"
+    ACTION_DEPENDENCIES["C:build"]="A:build"
+    ACTION_DEPENDENCIES["D:test"]=$'B:build\nC:build'
+    run print_execution_plan "D:test" "C:build" "B:build" "A:build"
+    [ "$status" -eq 0 ]
+    [ "${lines[0]}" = "Wave 1: A - build" ]
+    [ "${lines[1]}" = "Wave 2: C - build, B - build" ]
+    [ "${lines[2]}" = "Wave 3: D - test" ]
+    [ "${#lines[@]}" -eq 3 ]
+}
+
+@test "Plan: an action waits for its deepest dependency" {
+    # D depends on A directly and through B, so it must come after B
+    ACTION_DEPENDENCIES["B:build"]="A:build"
+    ACTION_DEPENDENCIES["D:test"]=$'A:build\nB:build'
+    run plan_waves "A:build" "B:build" "D:test"
+    [ "$output" = $'1\tA:build\n2\tB:build\n3\tD:test' ]
+}
+
+@test "Plan: dependencies outside the batch are not waited for" {
+    ACTION_DEPENDENCIES["B:test"]="B:build"
+    run print_execution_plan "B:test" "A:build"
+    [ "$output" = "Wave 1: B - test, A - build" ]
+}
+
+@test "Plan: cycles terminate and are reported" {
+    ACTION_DEPENDENCIES["X:one"]="Y:two"
+    ACTION_DEPENDENCIES["Y:two"]="X:one"
+    ACTION_DEPENDENCIES["Z:after"]="X:one"
+    run print_execution_plan "X:one" "Y:two" "Z:after" "W:free"
+    [ "$status" -eq 0 ]
+    [ "${lines[0]}" = "Wave 1: W - free" ]
+    [ "${lines[1]}" = "Not scheduled (dependency cycle): X - one, Y - two, Z - after" ]
+}
+
+@test "Plan: a self-dependency is a cycle" {
+    ACTION_DEPENDENCIES["S:loop"]="S:loop"
+    run print_execution_plan "S:loop"
+    [ "$output" = "Not scheduled (dependency cycle): S - loop" ]
+}
+
+@test "--explain prints the plan without running anything" {
+    run bash "$SHELL_BUN" --ci "TestApp*" build,deploy --explain "$TEST_FIXTURES/basic.cfg"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Execution plan for 3 action(s):" ]]
+    [[ "$output" =~ "Wave 1: TestApp1 - build, TestApp2 - build, TestApp2 - deploy" ]]
+    [[ ! "$output" =~ "Building TestApp1" ]]
+    [[ ! "$output" =~ "Starting:" ]]
+}
+
+@test "--explain requires CI mode" {
+    run bash "$SHELL_BUN" --explain "$TEST_FIXTURES/basic.cfg"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "--explain requires --ci" ]]
+}
@@ -0,0 +1,81 @@
+#!/usr/bin/env bats
+
+# Test exporting an app's actions as a standalone script (--export-script)
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_FIXTURES="$SCRIPT_DIR/tests/fixtures"
+    GOLDEN="$TEST_FIXTURES/golden"
+    EXPORTED="$BATS_TEST_TMPDIR/exported.sh"
+    # Keep the configured container active even when the tests run inside a container
+    export SHELL_BUN_CONTAINER_MARKER_FILE="$BATS_TEST_TMPDIR/no-containerenv"
+}
+
+@test "Export: host actions match the golden script" {
+    bash "$SHELL_BUN" --export-script ExportApp "$TEST_FIXTURES/export.cfg" > "$EXPORTED" 2>/dev/null
+    diff -u "$GOLDEN/export_ExportApp.sh" "$EXPORTED"
+}
+
+@test "Export: container actions match the golden script" {
+    bash "$SHELL_BUN" --export-script ContainerApp "$TEST_FIXTURES/export_container.cfg" > "$EXPORTED" 2>/dev/null
+    diff -u "$GOLDEN/export_ContainerApp.sh" "$EXPORTED"
+}
+
+@test "Export: --export-script=APP exports the same script" {
+    bash "$SHELL_BUN" --export-script=ExportApp "$TEST_FIXTURES/export.cfg" > "$EXPORTED" 2>/dev/null
+    diff -u "$GOLDEN/export_ExportApp.sh" "$EXPORTED"
+}
+
+@test "Export: output is deterministic" {
+    run bash -c "bash '$SHELL_BUN' --export-script ExportApp '$TEST_FIXTURES/export.cfg' 2>/dev/null | cksum"
+    local first="$output"
+    sleep 1
+    run bash -c "bash '$SHELL_BUN' --export-script ExportApp '$TEST_FIXTURES/export.cfg' 2>/dev/null | cksum"
+    [ "$output" == "$first" ]
+}
+
+@test "Export: status messages stay off stdout" {
+    run bash -c "bash '$SHELL_BUN' --export-script ExportApp '$TEST_FIXTURES/export.cfg' 2>/dev/null | head -n 1"
+    [ "$output" == "#!/usr/bin/env bash" ]
+}
+
+@test "Export: generated script dispatches actions" {
+    bash "$SHELL_BUN" --export-script ExportApp "$TEST_FIXTURES/export.cfg" > "$EXPORTED" 2>/dev/null
+    run bash "$EXPORTED" build
+    [ "$status" -eq 0 ]
+    [ "$output" == "Building ExportApp in /tmp" ]
+
+    run bash "$EXPORTED" test
+    [ "$status" -eq 3 ]
+    [ "$output" == "it's tested" ]
+
+    run bash "$EXPORTED" lint-all
+    [ "$status" -eq 0 ]
+    [ "$output" == "linting" ]
+}
+
+@test "Export: generated script rejects unknown actions" {
+    bash "$SHELL_BUN" --export-script ExportApp "$TEST_FIXTURES/export.cfg" > "$EXPORTED" 2>/dev/null
+    run bash "$EXPORTED" deploy
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "Usage:" ]]
+    [[ "$output" =~ "{build|test|lint-all}" ]]
+}
+
+@test "Export: unknown application is an error" {
+    run bash "$SHELL_BUN" --export-script NoSuchApp "$TEST_FIXTURES/export.cfg"
+    [ "$status" -eq 3 ]
+    [[ "$output" =~ "Application 'NoSuchApp' not found" ]]
+}
+
+@test "Export: application name is required" {
+    run bash "$SHELL_BUN" --export-script
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "--export-script requires an application name" ]]
+    run bash "$SHELL_BUN" --export-script=
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "--export-script requires an application name" ]]
+}
@@ -0,0 +1,90 @@
+#!/usr/bin/env bats
+
+# Test writing a selection of actions to a standalone script ('>' in the menu, --export)
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_CONFIG="$BATS_TEST_TMPDIR/export.cfg"
+    ORDER_FILE="$BATS_TEST_TMPDIR/order.txt"
+    WORK_DIR="$BATS_TEST_TMPDIR/work"
+    mkdir -p "$WORK_DIR"
+    # Keep the configured container active even when the tests run inside a container
+    export SHELL_BUN_CONTAINER_MARKER_FILE="$BATS_TEST_TMPDIR/no-containerenv"
+
+    cat > "$TEST_CONFIG" << EOF
+log_dir=$BATS_TEST_TMPDIR/logs
+
+[Lib]
+working_dir=$BATS_TEST_TMPDIR
+env_STAGE=lib
+build=echo "lib \$STAGE \$(pwd)" >> "$ORDER_FILE"
+
+[App]
+test=echo app-test >> "$ORDER_FILE"
+build=echo app-build >> "$ORDER_FILE"
+test.depends_on=build
+broken=exit 4
+EOF
+}
+
+@test "--export writes the matched actions to shell-bun-export.sh without running them" {
+    cd "$WORK_DIR"
+    run bash "$SHELL_BUN" --ci "*" build,test --export --no-trust-check "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Exported 3 action(s) to $WORK_DIR/shell-bun-export.sh" ]]
+    [ ! -e "$ORDER_FILE" ]
+    [ -x "$WORK_DIR/shell-bun-export.sh" ]
+    grep -q '^set -euo pipefail$' "$WORK_DIR/shell-bun-export.sh"
+    grep -q "^echo '=== Lib - build ==='$" "$WORK_DIR/shell-bun-export.sh"
+    grep -q "^    cd '$BATS_TEST_TMPDIR' || exit 1$" "$WORK_DIR/shell-bun-export.sh"
+}
+
+@test "The exported script runs the actions in plan order" {
+    cd "$WORK_DIR"
+    bash "$SHELL_BUN" --ci "*" build,test --export --no-trust-check "$TEST_CONFIG"
+    run bash "$WORK_DIR/shell-bun-export.sh"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "=== App - build ===" ]]
+    [ "$(tr '\n' ' ' < "$ORDER_FILE")" = "lib lib $BATS_TEST_TMPDIR app-build app-test " ]
+}
+
+@test "The exported script stops at the first failure" {
+    cd "$WORK_DIR"
+    bash "$SHELL_BUN" --ci App broken,build --export --sequential --no-trust-check "$TEST_CONFIG"
+    run bash "$WORK_DIR/shell-bun-export.sh"
+    [ "$status" -eq 4 ]
+    [[ "$output" =~ "=== App - broken ===" ]]
+    [[ ! "$output" =~ "=== App - build ===" ]]
+    [ ! -e "$ORDER_FILE" ]
+}
+
+@test "Exported commands are wrapped in the container command" {
+    sed -i '1i container=docker exec -i builder' "$TEST_CONFIG"
+    cd "$WORK_DIR"
+    run bash "$SHELL_BUN" --ci App build --export --no-trust-check "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    grep -q "^    docker exec -i builder bash -lc " "$WORK_DIR/shell-bun-export.sh"
+}
+
+@test "--export requires --ci" {
+    run bash "$SHELL_BUN" --export --no-trust-check "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "--export requires --ci" ]]
+}
+
+@test "'>' in the menu exports the selected actions" {
+    if ! script -qec true /dev/null >/dev/null 2>&1; then
+        skip "util-linux 'script' is required to emulate a terminal"
+    fi
+    cd "$WORK_DIR"
+    run bash -c "(sleep 1; printf 'App - test'; sleep 0.3; printf ' '; sleep 0.3; printf '>'; sleep 0.5; printf '\033'; sleep 0.3) | script -qec \"stty cols 200 rows 30; bash '$SHELL_BUN' --no-trust-check '$TEST_CONFIG'\" /dev/null"
+    [ "$status" -eq 0 ]
+    # build comes along as test depends on it
+    [[ "$output" =~ "Exported 2 action(s) to $WORK_DIR/shell-bun-export.sh" ]]
+    grep -q "^echo '=== App - build ==='$" "$WORK_DIR/shell-bun-export.sh"
+    grep -q "^echo '=== App - test ==='$" "$WORK_DIR/shell-bun-export.sh"
+    [ ! -e "$ORDER_FILE" ]
+}
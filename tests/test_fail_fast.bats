@@ -0,0 +1,87 @@
+#!/usr/bin/env bats
+
+# Test CI runs and menu batches that cancel the rest once an action fails (--fail-fast)
+# and the CI exit codes
+
+load helpers/terminal
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_CONFIG="$BATS_TEST_TMPDIR/pipeline.cfg"
+    ORDER_FILE="$BATS_TEST_TMPDIR/order.txt"
+    LOG_DIR="$BATS_TEST_TMPDIR/logs"
+
+    cat > "$TEST_CONFIG" << EOF
+log_dir=$LOG_DIR
+
+[Pipeline]
+allow_failure=lint
+slow=sleep 30; echo slow >> "$ORDER_FILE"
+broken=sleep 0.5; echo broken >> "$ORDER_FILE"; exit 2
+lint=echo lint >> "$ORDER_FILE"; exit 1
+package=echo package >> "$ORDER_FILE"
+package.after=slow
+EOF
+}
+
+@test "--fail-fast cancels running actions and does not start waiting ones" {
+    local started=$SECONDS
+    run bash "$SHELL_BUN" --ci Pipeline slow,broken,package --fail-fast "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [ $((SECONDS - started)) -lt 20 ]
+    [ "$(tr '\n' ' ' < "$ORDER_FILE")" = "broken " ]
+    [[ "$output" =~ "Stopping after Pipeline - broken failed: 1 action(s) cancelled, 1 not run" ]]
+    [[ "$output" =~ "Cancelled: Pipeline - slow" ]]
+    [[ "$output" =~ "Commands executed: 1" ]]
+    [[ "$output" =~ "Failed operations: 1" ]]
+    [[ "$output" =~ "Cancelled (--fail-fast):"$'\n'"  - Pipeline - slow"$'\n'"Not run:"$'\n'"  - Pipeline - package" ]]
+}
+
+@test "--fail-fast reports cancelled actions without an exit code" {
+    run bash -c "bash '$SHELL_BUN' --ci Pipeline slow,broken --fail-fast --output json '$TEST_CONFIG' 2>/dev/null"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ \"action\":\"slow\".*\"exit_code\":null,\"error\":\"cancelled:\ stopped\ after\ Pipeline\ -\ broken\ failed\" ]]
+}
+
+@test "--fail-fast does not stop for actions allowed to fail" {
+    run bash "$SHELL_BUN" --ci Pipeline lint,package --fail-fast "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ ! "$output" =~ "Aborted at" ]]
+}
+
+@test "--fail-fast needs a run that can stop at the first failure" {
+    run bash "$SHELL_BUN" --ci Pipeline lint --fail-fast --max-failures 2 "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "--fail-fast stops at the first failure and cannot be combined with --repeat, --max-failures or --min-pass-rate" ]]
+}
+
+@test "--fail-fast stops a batch started from the menu" {
+    require_terminal
+    local started=$SECONDS
+    run_terminal --fail-fast "$TEST_CONFIG" -- s l o w space ctrl-u b r o k e n space ctrl-u p a c k space enter wait:3 q esc
+    [ "$status" -eq 0 ]
+    [ $((SECONDS - started)) -lt 25 ]
+    [ "$(tr '\n' ' ' < "$ORDER_FILE")" = "broken " ]
+    [[ "$(plain_output)" =~ "Stopped after Pipeline - broken failed (--fail-fast)" ]]
+    [[ "$(plain_output)" =~ "FAILED: Pipeline - broken" ]]
+    [[ "$(plain_output)" =~ "CANCELLED: Pipeline - slow" ]]
+    [[ "$(plain_output)" =~ "SKIPPED: Pipeline - package" ]]
+    assert_log_matches Pipeline slow '^\[shell-bun\] Action cancelled after Pipeline - broken failed \(--fail-fast; SIGTERM sent to its process group\)'
+    assert_log_matches Pipeline package '^\[shell-bun\] Action skipped: stopped after Pipeline - broken failed \(--fail-fast\)'
+}
+
+@test "CI exit codes tell failed actions, configuration errors and unmatched patterns apart" {
+    run bash "$SHELL_BUN" --ci Pipeline broken "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    run bash "$SHELL_BUN" --ci Pipeline broken "$BATS_TEST_TMPDIR/missing.cfg"
+    [ "$status" -eq 2 ]
+    run bash "$SHELL_BUN" --ci Pipline broken "$TEST_CONFIG"
+    [ "$status" -eq 3 ]
+    run bash "$SHELL_BUN" --ci Pipeline biuld "$TEST_CONFIG"
+    [ "$status" -eq 3 ]
+    run bash -c "echo 'Pipeline nothing' | bash '$SHELL_BUN' --stdin-select '$TEST_CONFIG'"
+    [ "$status" -eq 3 ]
+}
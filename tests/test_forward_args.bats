@@ -0,0 +1,72 @@
+#!/usr/bin/env bats
+
+# Test forwarding arguments into commands through the {{args}} placeholder
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_CONFIG="$BATS_TEST_TMPDIR/args.cfg"
+
+    echo "log_dir=$BATS_TEST_TMPDIR/logs" > "$TEST_CONFIG"
+    cat >> "$TEST_CONFIG" << 'EOF'
+
+[App]
+test=printf '[%s]' {{args...}}; echo
+grep=printf '<%s>' {{args}}; echo
+build=echo "building"
+EOF
+}
+
+@test "Arguments after -- are splatted into {{args...}}" {
+    run bash "$SHELL_BUN" "$TEST_CONFIG" --ci App test -- --filter="My Case" 'a&b'
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "[--filter=My Case][a&b]" ]]
+}
+
+@test "{{args}} receives the arguments as one word" {
+    run bash "$SHELL_BUN" "$TEST_CONFIG" --ci App grep -- one two
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "<one two>" ]]
+}
+
+@test "Arguments can be given inside the action pattern" {
+    run bash "$SHELL_BUN" --ci App "test -- --filter='My Case' -v" "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "[--filter=My Case][-v]" ]]
+}
+
+@test "Placeholders are empty without arguments" {
+    run bash "$SHELL_BUN" --ci App test "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "[]" ]]
+    [ "$(echo "$output" | grep -c "{{args")" -eq 0 ]
+}
+
+@test "Actions without a placeholder reject arguments" {
+    run bash "$SHELL_BUN" "$TEST_CONFIG" --ci App build -- --verbose
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "Action 'build' of App does not take arguments (its command has no {{args}} placeholder)" ]]
+    [ "$(echo "$output" | grep -c "building")" -eq 0 ]
+}
+
+@test "Exported scripts forward their arguments to the placeholder" {
+    bash "$SHELL_BUN" --export-script App "$TEST_CONFIG" > "$BATS_TEST_TMPDIR/app.sh" 2>/dev/null
+    run bash "$BATS_TEST_TMPDIR/app.sh" test a "b c"
+    [ "$status" -eq 0 ]
+    [ "$output" = "[a][b c]" ]
+    run bash "$BATS_TEST_TMPDIR/app.sh" grep a "b c"
+    [ "$output" = "<a b c>" ]
+}
+
+@test "The interactive UI asks for arguments when the placeholder is present" {
+    if ! script -qec true /dev/null >/dev/null 2>&1; then
+        skip "util-linux 'script' is required to emulate a terminal"
+    fi
+    cd "$BATS_TEST_TMPDIR"
+    run bash -c "(sleep 1; printf 'test'; sleep 0.3; printf '\r'; sleep 0.5; printf -- '-k \"slow one\"\r'; sleep 1; printf '\r'; sleep 0.3; printf '\033'; sleep 0.3) | script -qec \"stty cols 200; bash '$SHELL_BUN' '$TEST_CONFIG'\" /dev/null"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Arguments for App - test:" ]]
+    [[ "$output" =~ "[-k][slow one]" ]]
+}
@@ -0,0 +1,73 @@
+#!/usr/bin/env bats
+
+# Test the min_free_space check before a run starts
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_CONFIG="$BATS_TEST_TMPDIR/space.cfg"
+    LOG_DIR="$BATS_TEST_TMPDIR/logs"
+
+    cat > "$TEST_CONFIG" << EOF
+log_dir=$LOG_DIR
+min_free_space=1000T
+
+[App]
+working_dir=$BATS_TEST_TMPDIR
+build=echo "built"
+EOF
+}
+
+@test "CI runs stop when a working directory has less than min_free_space free" {
+    run bash "$SHELL_BUN" --ci App build "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "Error: Less than 1000.0 TiB (min_free_space) is free on:" ]]
+    [[ "$output" =~ " free ($BATS_TEST_TMPDIR)" ]]
+    [[ "$output" =~ "Nothing was run." ]]
+    [[ ! "$output" =~ "built" ]]
+}
+
+@test "--ignore-space runs anyway with a warning" {
+    run bash "$SHELL_BUN" --ci App build --ignore-space "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Less than 1000.0 TiB (min_free_space) is free on:" ]]
+    [[ "$output" =~ "built" ]]
+}
+
+@test "Enough free space, dry runs and container working directories pass" {
+    sed -i 's/^min_free_space=.*/min_free_space=1K/' "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --ci App build "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "built" ]]
+
+    sed -i 's/^min_free_space=.*/min_free_space=1000T/' "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --ci App build --dry-run "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    # Host paths do not apply in a container (env runs the command on the host here)
+    run bash "$SHELL_BUN" --ci App build --container env "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ ! "$output" =~ "min_free_space" ]]
+    [[ "$output" =~ "built" ]]
+}
+
+@test "Invalid min_free_space is ignored with a warning" {
+    sed -i 's/^min_free_space=.*/min_free_space=lots/' "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --ci App build "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Ignoring invalid min_free_space 'lots' (expected a size like 2G, 500M or 0)" ]]
+}
+
+@test "Menu runs ask before starting when the log directory is short of space" {
+    if ! script -qec true /dev/null >/dev/null 2>&1; then
+        skip "util-linux 'script' is required to emulate a terminal"
+    fi
+    run bash -c "(sleep 1; printf '\r'; sleep 0.5; printf 'n\r'; sleep 0.5; printf '\033'; sleep 0.3) | script -qec \"stty cols 200 rows 30; bash '$SHELL_BUN' --no-trust-check '$TEST_CONFIG'\" /dev/null"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Less than 1000.0 TiB (min_free_space) is free on:" ]]
+    [[ "$output" =~ " free ($LOG_DIR)" ]]
+    # The prompt shows while the menu runs, not only once it exits
+    [[ "${output%%Goodbye!*}" =~ "Run anyway? [y/N]" ]]
+    [ ! -d "$LOG_DIR" ]
+}
@@ -0,0 +1,126 @@
+#!/usr/bin/env bats
+
+# Test the ranked fuzzy matching of the menu filter
+
+load helpers/terminal
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_CONFIG="$BATS_TEST_TMPDIR/fuzzy.cfg"
+    LOG_DIR="$BATS_TEST_TMPDIR/logs"
+
+    # Load just the helpers; sourcing the whole script would start the UI
+    eval "$(sed -n '/^# Text rendering helpers/,/^# Debug logging function/p' "$SHELL_BUN")"
+    eval "$(sed -n '/^# Function to score how well a menu filter/,/^# Function to select all currently filtered/p' "$SHELL_BUN")"
+
+    cat > "$TEST_CONFIG" << EOF
+log_dir=$LOG_DIR
+
+[Web]
+rebuild-all=echo rebuild
+build-debug=echo debug
+build=echo build
+lint=echo lint
+EOF
+}
+
+@test "Items without the filter's characters in order score 0" {
+    fuzzy_score "bld" "Web - lint"
+    [ "$FUZZY_SCORE" -eq 0 ]
+    fuzzy_score "dlb" "Web - build"
+    [ "$FUZZY_SCORE" -eq 0 ]
+    fuzzy_score "BLD" "Web - build"
+    [ "$FUZZY_SCORE" -gt 0 ]
+    [ "${FUZZY_POSITIONS[*]}" = "6 9 10" ]
+}
+
+@test "Exact words rank above word starts, substrings and scattered matches" {
+    fuzzy_score "build" "Web - build"
+    local exact=$FUZZY_SCORE
+    fuzzy_score "build" "Web - build-debug"
+    local word_start=$FUZZY_SCORE
+    fuzzy_score "build" "Web - rebuild-all"
+    local substring=$FUZZY_SCORE
+    fuzzy_score "build" "Web - b-u-i-l-d"
+    local scattered=$FUZZY_SCORE
+    [ "$exact" -gt "$word_start" ]
+    [ "$word_start" -gt "$substring" ]
+    [ "$substring" -gt "$scattered" ]
+
+    # Scattered matches forming a whole word score higher
+    fuzzy_score "bld" "Web - build"
+    local word=$FUZZY_SCORE
+    fuzzy_score "bld" "Web - build-debug"
+    [ "$word" -gt "$FUZZY_SCORE" ]
+    local word_start=$FUZZY_SCORE
+    fuzzy_score "bld" "Web - rebuild-all"
+    [ "$word_start" -eq "$FUZZY_SCORE" ]
+
+    fuzzy_score "web" "Web - build"
+    local prefix=$FUZZY_SCORE
+    fuzzy_score "web" "Api - webhook"
+    [ "$prefix" -gt "$FUZZY_SCORE" ]
+}
+
+@test "Ranking drops non-matches and keeps the order of equal scores" {
+    run rank_menu_items "bld" "Web - rebuild-all" "Web - lint" "Web - build-debug" "Web - build" "Api - build"
+    [ "$status" -eq 0 ]
+    [ "$output" = $'Web - build\nApi - build\nWeb - rebuild-all\nWeb - build-debug' ]
+
+    run rank_menu_items "" "Web - lint" "Web - build"
+    [ "$output" = $'Web - lint\nWeb - build' ]
+}
+
+@test "Matched characters are highlighted, also in wide and accented text" {
+    [ "$(highlight_positions "build" "[" "]" 0 2)" = "[b]u[i]ld" ]
+    fuzzy_score "éb" "Wéb - 日本"
+    [ "$(highlight_positions "Wéb - 日本" "[" "]" "${FUZZY_POSITIONS[@]}")" = "W[é][b] - 日本" ]
+}
+
+@test "The menu lists the best matches of the filter first" {
+    require_terminal
+    run_terminal "$TEST_CONFIG" -- b l d enter wait:1 enter esc
+    [ "$status" -eq 0 ]
+    local menu
+    menu=$(plain_output | grep -a -m1 -A4 '^Filter: bld' | tail -3)
+    [ "$(echo "$menu" | sed -n 1p)" = "► Web - build" ]
+    [ "$(echo "$menu" | sed -n 2p)" = "  Web - rebuild-all" ]
+    [ "$(echo "$menu" | sed -n 3p)" = "  Web - build-debug" ]
+    # Enter runs the best match
+    [[ "$(plain_output)" =~ "Completed: Web - build" ]]
+}
+
+@test "app:action and app/action match the app and the action name separately" {
+    local -a items=("Web - build" "Web - test" "Api - build" "Builder - run" "Web - Show Details")
+    run rank_menu_items "build" "${items[@]}"
+    [ "$output" = $'Web - build\nApi - build\nBuilder - run' ]
+    run rank_menu_items "web:b" "${items[@]}"
+    [ "$output" = "Web - build" ]
+    run rank_menu_items "/bld" "${items[@]}"
+    [ "$output" = $'Web - build\nApi - build' ]
+    run rank_menu_items "bu:" "${items[@]}"
+    [ "$output" = "Builder - run" ]
+
+    menu_filter_score "ap/bd" "Api - build"
+    [ "$(highlight_positions "Api - build" "[" "]" "${FUZZY_POSITIONS[@]}")" = "[A][p]i - [b]uil[d]" ]
+}
+
+@test "The highlighted item stays highlighted while it matches the filter" {
+    require_terminal
+    # For "bl" build-debug is second; it stays highlighted as the last match of "bld"
+    run_terminal "$TEST_CONFIG" -- b l down d enter wait:1 enter esc
+    [ "$status" -eq 0 ]
+    [[ "$(plain_output | grep -a -m1 -A5 '^Filter: bld')" =~ "► Web - build-debug" ]]
+    [[ "$(plain_output)" =~ "Completed: Web - build-debug" ]]
+}
+
+@test "Typing highlights the best match when the cursor was on the first item" {
+    require_terminal
+    run_terminal "$TEST_CONFIG" -- w e b : l enter wait:1 enter esc
+    [ "$status" -eq 0 ]
+    [[ "$(plain_output | grep -a -m1 -A2 '^Filter: web:l')" =~ "► Web - lint" ]]
+    [[ "$(plain_output)" =~ "Completed: Web - lint" ]]
+}
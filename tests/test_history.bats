@@ -0,0 +1,132 @@
+#!/usr/bin/env bats
+
+# Test the run history (history.jsonl and the history view)
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_CONFIG="$BATS_TEST_TMPDIR/history.cfg"
+    LOG_DIR="$BATS_TEST_TMPDIR/logs"
+    STATE_DIR="$BATS_TEST_TMPDIR/state"
+
+    cat > "$TEST_CONFIG" << EOF
+log_dir=$LOG_DIR
+
+[Portal]
+build=echo "Building Portal"
+test=echo "Testing Portal"; exit 2
+EOF
+}
+
+# Feed the given keys to the menu, started with any further options
+run_menu_keys() {
+    local keys="$1"
+    shift
+    run bash -c "(sleep 1; printf '$keys'; sleep 0.5; printf '\033'; sleep 0.3) | script -qec \"stty rows 30 cols 200; bash '$SHELL_BUN' --state-dir '$STATE_DIR' $* '$TEST_CONFIG'\" /dev/null"
+}
+
+@test "CI runs append one record per action to the history" {
+    run bash "$SHELL_BUN" --state-dir "$STATE_DIR" --ci Portal all --tag nightly "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    run cat "$STATE_DIR"/*/history.jsonl
+    [ "${#lines[@]}" -eq 2 ]
+    [[ "${lines[0]}" =~ ^\{\"run_id\":\"[0-9]{8}_[0-9]{6}-[0-9]+\",\"mode\":\"ci\",\"config\":\".*history.cfg\",\"app\":\"Portal\",\"action\":\"build\",\"command\":\"bash\ -c\ .*\",\"success\":true,\"exit_code\":0,\"started_at\":\"[0-9-]+T[0-9:]+Z\",\"finished_at\":\"[0-9-]+T[0-9:]+Z\",\"duration\":[0-9]+,\"log_path\":null,\"tags\":\[\"nightly\"\]\}$ ]]
+    [[ "${lines[1]}" =~ \"action\":\"test\",.*\"success\":false,\"exit_code\":2, ]]
+}
+
+@test "history_file moves the history; dry runs are not recorded" {
+    echo "history_file=$BATS_TEST_TMPDIR/shared/history.jsonl" | cat - "$TEST_CONFIG" > "$TEST_CONFIG.new"
+    mv "$TEST_CONFIG.new" "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --state-dir "$STATE_DIR" --ci Portal build "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [ "$(wc -l < "$BATS_TEST_TMPDIR/shared/history.jsonl")" -eq 1 ]
+    [ ! -e "$(echo "$STATE_DIR"/*/history.jsonl)" ]
+    run bash "$SHELL_BUN" --state-dir "$STATE_DIR" --ci Portal build --dry-run "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [ "$(wc -l < "$BATS_TEST_TMPDIR/shared/history.jsonl")" -eq 1 ]
+}
+
+@test "history_max drops the oldest records" {
+    printf 'history_max=3\n' | cat - "$TEST_CONFIG" > "$TEST_CONFIG.new"
+    mv "$TEST_CONFIG.new" "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --state-dir "$STATE_DIR" --ci Portal build --tag first "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --state-dir "$STATE_DIR" --ci Portal all "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --state-dir "$STATE_DIR" --ci Portal build --tag last "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    run cat "$STATE_DIR"/*/history.jsonl
+    [ "${#lines[@]}" -eq 3 ]
+    [[ ! "$output" =~ \"first\" ]]
+    [[ "${lines[2]}" =~ \"tags\":\[\"last\"\] ]]
+
+    printf 'history_max=lots\n' | cat - "$TEST_CONFIG" > "$TEST_CONFIG.new"
+    mv "$TEST_CONFIG.new" "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --state-dir "$STATE_DIR" --ci Portal build "$TEST_CONFIG"
+    [[ "$output" =~ "Ignoring invalid history_max 'lots' (expected a number of records)" ]]
+}
+
+@test "An unwritable history does not fail the run" {
+    touch "$BATS_TEST_TMPDIR/file"
+    echo "history_file=$BATS_TEST_TMPDIR/file/history.jsonl" | cat - "$TEST_CONFIG" > "$TEST_CONFIG.new"
+    mv "$TEST_CONFIG.new" "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --state-dir "$STATE_DIR" --ci Portal build "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Completed: Portal - build" ]]
+}
+
+@test "Interactive runs are recorded with their logs and listed newest first with <" {
+    if ! script -qec true /dev/null >/dev/null 2>&1; then
+        skip "util-linux 'script' is required to emulate a terminal"
+    fi
+    # Run Portal - test from the menu, then open the history
+    run_menu_keys "\033[B\r\"; sleep 2; printf \"\r\"; sleep 0.5; printf \"<\"; sleep 0.5; printf \"q"
+    [ "$status" -eq 0 ]
+    run cat "$STATE_DIR"/*/history.jsonl
+    [ "${#lines[@]}" -eq 1 ]
+    [[ "${lines[0]}" =~ \"mode\":\"interactive\",.*\"action\":\"test\",.*\"exit_code\":2,.*\"log_path\":\"$LOG_DIR/[0-9_]+_Portal_test.log\" ]]
+
+    bash "$SHELL_BUN" --state-dir "$STATE_DIR" --ci Portal build "$TEST_CONFIG" >/dev/null
+    run_menu_keys "<\"; sleep 0.5; printf \"q"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Run history: the last 2 run(s), newest first" ]]
+    [[ "$output" =~ "► ✅ "[0-9-]+" "[0-9:]+" "+"just now  Portal - build" ]]
+    [[ "$output" =~ "  ❌ "[0-9-]+" "[0-9:]+" "+"just now  Portal - test "+"0s (exit 2)" ]]
+}
+
+@test "Enter in the history view opens the log, or says it is gone" {
+    if ! script -qec true /dev/null >/dev/null 2>&1; then
+        skip "util-linux 'script' is required to emulate a terminal"
+    fi
+    mkdir -p "$LOG_DIR"
+    echo "Old output" > "$LOG_DIR/old.log"
+    cat > "$BATS_TEST_TMPDIR/history.jsonl" << EOF
+{"run_id":"1","mode":"interactive","config":"x","app":"Portal","action":"build","command":"x","success":true,"exit_code":0,"started_at":"2026-01-02T03:04:05Z","finished_at":"2026-01-02T03:04:07Z","duration":2,"log_path":"$LOG_DIR/old.log","tags":[]}
+{"run_id":"2","mode":"interactive","config":"x","app":"Portal","action":"test","command":"x","success":false,"exit_code":1,"started_at":"2026-01-02T03:05:05Z","finished_at":"2026-01-02T03:05:07Z","duration":2,"log_path":"$LOG_DIR/gone.log","tags":[]}
+EOF
+    echo "history_file=$BATS_TEST_TMPDIR/history.jsonl" | cat - "$TEST_CONFIG" > "$TEST_CONFIG.new"
+    mv "$TEST_CONFIG.new" "$TEST_CONFIG"
+    # The newest run (its log is gone) is listed first, the one with a log below it
+    run_menu_keys "<\"; sleep 0.5; printf \"\r\"; sleep 0.5; printf \"\033[B\"; sleep 0.3; printf \"\r\"; sleep 0.5; printf \"q\"; sleep 0.3; printf \"q"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Log file no longer exists: $LOG_DIR/gone.log" ]]
+    [[ "$output" =~ "Old output" ]]
+}
+
+@test "The history view shows local times, or UTC with --utc, and how long ago runs were" {
+    if ! script -qec true /dev/null >/dev/null 2>&1; then
+        skip "util-linux 'script' is required to emulate a terminal"
+    fi
+    cat > "$BATS_TEST_TMPDIR/history.jsonl" << EOF
+{"run_id":"1","mode":"ci","config":"x","app":"Portal","action":"build","command":"x","success":true,"exit_code":0,"started_at":"2026-01-02T01:59:00Z","finished_at":"2026-01-02T03:04:07Z","duration":3907,"log_path":null,"tags":[]}
+EOF
+    echo "history_file=$BATS_TEST_TMPDIR/history.jsonl" | cat - "$TEST_CONFIG" > "$TEST_CONFIG.new"
+    mv "$TEST_CONFIG.new" "$TEST_CONFIG"
+    run_menu_keys "<\"; sleep 0.5; printf \"q" --utc
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "2026-01-02 03:04 UTC "[0-9]+"d ago "+"Portal - build "+"1h05m" ]]
+
+    TZ=Asia/Tokyo run_menu_keys "<\"; sleep 0.5; printf \"q"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "2026-01-02 12:04 "+[0-9]+"d ago "+"Portal - build" ]]
+}
@@ -0,0 +1,61 @@
+#!/usr/bin/env bats
+
+# Test the idle_timeout auto-exit of the interactive UI
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_CONFIG="$BATS_TEST_TMPDIR/idle.cfg"
+    # Keep the tests short: a 2 second countdown instead of 60
+    export SHELL_BUN_IDLE_COUNTDOWN=2
+
+    # The interactive UI needs a terminal; util-linux 'script' provides one
+    if ! script -qec true /dev/null >/dev/null 2>&1; then
+        skip "util-linux 'script' is required to emulate a terminal"
+    fi
+
+    cat > "$TEST_CONFIG" << EOF
+log_dir=$BATS_TEST_TMPDIR/logs
+idle_timeout=2s
+
+[Portal]
+build=echo "Building Portal"
+EOF
+}
+
+@test "Idle UI counts down and exits" {
+    run bash -c "(sleep 7) | script -qec \"bash '$SHELL_BUN' '$TEST_CONFIG'\" /dev/null"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "No activity for 2s - exiting in 2s. Press any key to stay." ]]
+    [[ "$output" =~ "Exited after 2s without activity (idle_timeout)." ]]
+}
+
+@test "A key during the countdown keeps the UI open" {
+    run bash -c "(sleep 3.2; printf 'x'; sleep 0.5; printf '\177'; sleep 0.5; printf '\033'; sleep 0.3) | script -qec \"bash '$SHELL_BUN' '$TEST_CONFIG'\" /dev/null"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "exiting in" ]]
+    [[ ! "$output" =~ "Exited after" ]]
+    [[ "$output" =~ "Goodbye!" ]]
+}
+
+@test "Keypresses restart the idle timer" {
+    # A key every second never leaves the UI idle for 2 seconds
+    run bash -c "(for i in 1 2 3 4 5; do sleep 1; printf 'a'; done; sleep 0.3; printf '\033'; sleep 0.3) | script -qec \"bash '$SHELL_BUN' '$TEST_CONFIG'\" /dev/null"
+    [ "$status" -eq 0 ]
+    [[ ! "$output" =~ "exiting in" ]]
+    [[ "$output" =~ "Goodbye!" ]]
+}
+
+@test "Invalid idle_timeout values are reported and ignored" {
+    cat > "$TEST_CONFIG" << EOF
+idle_timeout=soon
+
+[Portal]
+build=echo "Building Portal"
+EOF
+    run bash "$SHELL_BUN" --validate "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Ignoring invalid idle_timeout 'soon'" ]]
+}
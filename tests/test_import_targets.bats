@@ -0,0 +1,115 @@
+#!/usr/bin/env bats
+
+# Test actions imported from a Makefile or package.json (import_targets)
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_CONFIG="$BATS_TEST_TMPDIR/import.cfg"
+    PROJECT="$BATS_TEST_TMPDIR/project"
+    STATE_DIR="$BATS_TEST_TMPDIR/state"
+    mkdir -p "$PROJECT"
+
+    printf 'hello:\n\t@echo "hello from make"\nbuild:\n\t@echo "make build"\n' > "$PROJECT/Makefile"
+    printf '{"scripts": {"lint": "eslint .", "build:prod": "tsc -p prod"}}\n' > "$PROJECT/package.json"
+
+    cat > "$TEST_CONFIG" << EOF
+[Make]
+working_dir=$PROJECT
+import_targets=makefile
+build=echo "explicit build"
+
+[Npm]
+working_dir=$PROJECT
+import_targets=npm
+EOF
+}
+
+@test "Make targets become actions that run make" {
+    run bash "$SHELL_BUN" --state-dir "$STATE_DIR" --ci Make hello "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Starting: Make - hello" ]]
+    [[ "$output" =~ "bash -c make\\ hello" ]]
+    [[ "$output" =~ "hello from make" ]]
+}
+
+@test "Actions defined in the config win over imported ones" {
+    run bash "$SHELL_BUN" --state-dir "$STATE_DIR" --ci Make build "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "explicit build" ]]
+    [[ ! "$output" =~ "make build" ]]
+}
+
+@test "npm scripts become actions, names that cannot be addressed are reported" {
+    if ! command -v jq >/dev/null 2>&1 && ! command -v node >/dev/null 2>&1; then
+        skip "jq or node is required to read package.json"
+    fi
+    run bash "$SHELL_BUN" --state-dir "$STATE_DIR" --ci Npm lint --dry-run "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "bash -c npm\\ run\\ lint" ]]
+    [[ "$output" =~ "Skipped imported npm targets of [Npm] that cannot be used as action names: 'build:prod'" ]]
+}
+
+@test "A missing Makefile is reported without stopping the config from loading" {
+    rm "$PROJECT/Makefile"
+    run bash "$SHELL_BUN" --state-dir "$STATE_DIR" --ci Make build "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Could not import makefile targets of [Make]: no Makefile in $PROJECT ($TEST_CONFIG:3)" ]]
+    [[ "$output" =~ "explicit build" ]]
+}
+
+@test "Targets are cached until the Makefile changes" {
+    run bash "$SHELL_BUN" --state-dir "$STATE_DIR" --ci Make hello --dry-run "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+
+    # A make that fails to list targets is only asked again once the Makefile changed
+    mkdir -p "$BATS_TEST_TMPDIR/bin"
+    printf '#!/bin/sh\nexit 2\n' > "$BATS_TEST_TMPDIR/bin/make"
+    chmod +x "$BATS_TEST_TMPDIR/bin/make"
+    run env PATH="$BATS_TEST_TMPDIR/bin:$PATH" bash "$SHELL_BUN" --state-dir "$STATE_DIR" --ci Make hello --dry-run "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "[dry-run] cd '$PROJECT' && bash -c make\\ hello" ]]
+
+    printf 'other:\n\t@true\n' >> "$PROJECT/Makefile"
+    run env PATH="$BATS_TEST_TMPDIR/bin:$PATH" bash "$SHELL_BUN" --state-dir "$STATE_DIR" --ci Make build "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Could not import makefile targets of [Make]: make failed or took longer than 10s" ]]
+}
+
+@test "Nothing is evaluated before the config is trusted" {
+    unset SHELL_BUN_NO_TRUST_CHECK
+    local tool
+    mkdir -p "$BATS_TEST_TMPDIR/bin"
+    for tool in make jq node; do
+        printf '#!/bin/sh\ntouch "%s/ran-%s"\nexit 2\n' "$BATS_TEST_TMPDIR" "$tool" > "$BATS_TEST_TMPDIR/bin/$tool"
+        chmod +x "$BATS_TEST_TMPDIR/bin/$tool"
+    done
+
+    run env PATH="$BATS_TEST_TMPDIR/bin:$PATH" bash "$SHELL_BUN" --state-dir "$STATE_DIR" --ci Make hello "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "Refusing to run commands from an untrusted configuration" ]]
+    run env PATH="$BATS_TEST_TMPDIR/bin:$PATH" bash "$SHELL_BUN" --state-dir "$STATE_DIR" --list '*' "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ ! "$output" =~ "hello" ]]
+    [ -z "$(compgen -G "$BATS_TEST_TMPDIR/ran-*")" ]
+
+    # Once trusted, the targets are imported
+    run bash "$SHELL_BUN" --state-dir "$STATE_DIR" --trust --ci Make hello "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "hello from make" ]]
+    run bash -c "bash '$SHELL_BUN' --state-dir '$STATE_DIR' --list Make '$TEST_CONFIG' 2>/dev/null"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ $'Make\thello' ]]
+}
+
+@test "Details mark imported actions with their source" {
+    if ! script -qec true /dev/null >/dev/null 2>&1; then
+        skip "util-linux 'script' is required to emulate a terminal"
+    fi
+    run bash -c "(sleep 1; printf 'details'; sleep 0.3; printf '\\r'; sleep 0.5; printf '\\r'; sleep 0.5; printf '\033'; sleep 0.3) | script -qec \"stty cols 200; bash '$SHELL_BUN' --no-trust-check --state-dir '$STATE_DIR' '$TEST_CONFIG'\" /dev/null"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Imported from: $PROJECT/Makefile (import_targets at $TEST_CONFIG:3)" ]]
+    [[ "$output" =~ "Defined at: $TEST_CONFIG:4" ]]
+}
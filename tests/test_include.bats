@@ -0,0 +1,172 @@
+#!/usr/bin/env bats
+
+# Test configs that include others (include=PATH)
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    PROJECT="$BATS_TEST_TMPDIR/project"
+    TEST_CONFIG="$PROJECT/variant/shell-bun.cfg"
+    mkdir -p "$PROJECT/shared/src" "$PROJECT/variant"
+
+    cat > "$PROJECT/shared/common.cfg" << 'EOF'
+log_dir=logs
+max_parallel=1
+
+[Web]
+working_dir=src
+build=echo "common build in $PWD"
+test=echo "common test"
+EOF
+    cat > "$TEST_CONFIG" << 'EOF'
+include = ../shared/common.cfg
+
+[Web]
+test=echo "variant test"
+deploy=echo "variant deploy"
+EOF
+}
+
+@test "Sections after an include add to and override its apps" {
+    run bash "$SHELL_BUN" --ci Web all --no-trust-check "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Running 3 action(s), max 1 in parallel..." ]]
+    [[ "$output" =~ "variant test" ]]
+    [[ "$output" =~ "variant deploy" ]]
+    [[ ! "$output" =~ "common test" ]]
+    # Overriding an included action is not a duplicate
+    [[ ! "$output" =~ "defined twice" ]]
+}
+
+@test "working_dir and log_dir are relative to the file they are written in" {
+    run bash "$SHELL_BUN" --ci Web build "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "common build in $PROJECT/shared/src" ]]
+
+    cat >> "$TEST_CONFIG" << 'EOF'
+
+[Api]
+log_dir=api-logs
+check=echo "api check"
+EOF
+    # Paths in the top-level config keep their usual base, the script directory
+    run bash "$SHELL_BUN" --validate "$TEST_CONFIG"
+    [[ "$output" =~ "log_dir: $PROJECT/shared/logs does not exist yet" ]]
+    [[ "$output" =~ "[Api] log_dir: $SCRIPT_DIR/api-logs does not exist yet" ]]
+}
+
+@test "Includes are read in order, nested ones relative to their own file" {
+    mkdir -p "$PROJECT/shared/more"
+    sed -i '1i include=more/tools.cfg' "$PROJECT/shared/common.cfg"
+    cat > "$PROJECT/shared/more/tools.cfg" << 'EOF'
+[Tools]
+lint=echo "tools lint"
+EOF
+    cat > "$PROJECT/shared/extra.cfg" << 'EOF'
+max_parallel=3
+
+[Web]
+build=echo "extra build"
+EOF
+    cat > "$TEST_CONFIG" << 'EOF'
+include = ../shared/common.cfg
+include = ../shared/extra.cfg
+max_parallel=2
+
+[Tools]
+lint=echo "variant lint"
+EOF
+    run bash "$SHELL_BUN" --ci "*" all "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    # Whatever is read later wins; apps of the including file come first
+    [[ "$output" =~ "Matched apps: Tools Web" ]]
+    [[ "$output" =~ "Running 3 action(s), max 2 in parallel..." ]]
+    [[ "$output" =~ "extra build" ]]
+    [[ "$output" =~ "variant lint" ]]
+    [[ ! "$output" =~ "tools lint" ]]
+}
+
+@test "Apps of the including file are listed before included ones" {
+    mkdir -p "$PROJECT/shared/more"
+    sed -i '1i include=more/tools.cfg' "$PROJECT/shared/common.cfg"
+    printf '[Tools]\nlint=echo lint\n' > "$PROJECT/shared/more/tools.cfg"
+    printf '[Docs]\nbuild=echo docs\n' > "$PROJECT/shared/docs.cfg"
+    sed -i '1a include=../shared/docs.cfg' "$TEST_CONFIG"
+    echo "[Api]" >> "$TEST_CONFIG"
+    echo "check=echo check" >> "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --ci "*" build --dry-run "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    # Depth first: this file's apps, then common.cfg's, then those of its include, then docs.cfg's
+    [[ "$output" =~ "Matched apps: Web Api Tools Docs" ]]
+
+    run bash "$SHELL_BUN" --validate "$TEST_CONFIG"
+    [[ "$output" =~ "Included files:"$'\n'"  $PROJECT/shared/common.cfg"$'\n'"  $PROJECT/shared/more/tools.cfg"$'\n'"  $PROJECT/shared/docs.cfg" ]]
+}
+
+@test "Warnings point at the included file" {
+    echo "web.timeout=soon" >> "$PROJECT/shared/common.cfg"
+    run bash "$SHELL_BUN" --validate "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "Ignoring invalid web.timeout 'soon' in [Web] (expected a duration like 2m30s, 15m or 90s) ($PROJECT/shared/common.cfg:8)" ]]
+
+    echo "include=more.cfg" >> "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --validate "$TEST_CONFIG"
+    [[ "$output" =~ "[Web] include: includes are only read before the first section; this line defines an action named 'include' ($TEST_CONFIG:6)" ]]
+}
+
+@test "A glob include reads the matching files in name order" {
+    mkdir -p "$PROJECT/variant/conf.d"
+    printf '[Web]\nbuild=echo "web build"\n' > "$PROJECT/variant/conf.d/20-web.cfg"
+    printf '[Api]\nbuild=echo "api build"\n' > "$PROJECT/variant/conf.d/10-api.cfg"
+    printf 'include=conf.d/*.cfg\ninclude=none.d/*.cfg\n[Main]\nbuild=echo main\n' > "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --ci "*" build --dry-run "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Matched apps: Main Api Web" ]]
+
+    run bash "$SHELL_BUN" --validate "$TEST_CONFIG"
+    [[ "$output" =~ "Included files:"$'\n'"  $PROJECT/variant/conf.d/10-api.cfg"$'\n'"  $PROJECT/variant/conf.d/20-web.cfg" ]]
+    [[ "$output" =~ "include=none.d/*.cfg matches no files ($TEST_CONFIG:2)" ]]
+}
+
+@test "An app defined in two files that do not include each other is reported" {
+    mkdir -p "$PROJECT/variant/conf.d"
+    printf '[Web]\nbuild=echo "team a"\n' > "$PROJECT/variant/conf.d/a.cfg"
+    printf '\n[Web]\nbuild=echo "team b"\n' > "$PROJECT/variant/conf.d/b.cfg"
+    printf 'include=conf.d/*.cfg\n[Web]\ntest=echo test\n' > "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --validate "$TEST_CONFIG"
+    [[ "$output" =~ "[Web] app is also defined at $PROJECT/variant/conf.d/a.cfg:1; this section adds to it and overrides its actions with the same names ($PROJECT/variant/conf.d/b.cfg:2)" ]]
+    # The including file adds to its includes' apps without a warning
+    [ "$(echo "$output" | grep -c "app is also defined")" -eq 1 ]
+
+    run bash "$SHELL_BUN" --strict --validate "$TEST_CONFIG"
+    [ "$status" -ne 0 ]
+    [[ "$output" =~ "Error: [Web] app defined in two files, at $PROJECT/variant/conf.d/a.cfg:1 and $PROJECT/variant/conf.d/b.cfg:2" ]]
+}
+
+@test "Circular and missing includes stop the config from loading" {
+    sed -i '1i include=../variant/shell-bun.cfg' "$PROJECT/shared/common.cfg"
+    cd "$PROJECT"
+    run bash "$SHELL_BUN" --validate variant/shell-bun.cfg
+    [ "$status" -eq 2 ]
+    [[ "$output" =~ "Error: Circular include: variant/shell-bun.cfg -> shared/common.cfg -> variant/shell-bun.cfg (shared/common.cfg:1)" ]]
+
+    echo "include=missing.cfg" > variant/shell-bun.cfg
+    run bash "$SHELL_BUN" --validate variant/shell-bun.cfg
+    [ "$status" -eq 2 ]
+    [[ "$output" =~ "Error: Included configuration file 'variant/missing.cfg' not found (variant/shell-bun.cfg:1)" ]]
+}
+
+@test "Changing an included file requires trusting the config again" {
+    unset SHELL_BUN_NO_TRUST_CHECK
+    export SHELL_BUN_TRUST_STORE="$BATS_TEST_TMPDIR/trusted_configs"
+    cd "$PROJECT/variant"
+    run bash "$SHELL_BUN" --trust --ci Web test
+    [ "$status" -eq 0 ]
+
+    echo "extra=echo extra" >> "$PROJECT/shared/common.cfg"
+    run bash "$SHELL_BUN" --ci Web test
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "Refusing to run commands from an untrusted configuration" ]]
+}
@@ -0,0 +1,63 @@
+#!/usr/bin/env bats
+
+# Test actions marked !interactive! that run attached to the terminal
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_CONFIG="$BATS_TEST_TMPDIR/interactive.cfg"
+    LOG_DIR="$BATS_TEST_TMPDIR/logs"
+
+    cat > "$TEST_CONFIG" << EOF
+log_dir=$LOG_DIR
+
+[Kernel]
+menuconfig=!interactive! read -r -p "Name? " name; echo "hello \$name"; [ -t 1 ] && echo "on a terminal"; exit 4
+build=echo "building"
+EOF
+}
+
+@test "CI mode refuses actions that need the terminal" {
+    run bash "$SHELL_BUN" --ci Kernel all "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "Error: 1 action(s) need the terminal (!interactive!) and cannot run in CI mode:" ]]
+    [[ "$output" =~ "  Kernel - menuconfig" ]]
+    [[ ! "$output" =~ "building" ]]
+
+    # The marker is not part of the command
+    run bash "$SHELL_BUN" --ci Kernel menuconfig --dry-run "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "[dry-run] cd " ]]
+    [[ ! "$output" =~ "!interactive!" ]]
+}
+
+@test "A single run is attached to the terminal and its output is logged" {
+    if ! script -qec true /dev/null >/dev/null 2>&1; then
+        skip "util-linux 'script' is required to emulate a terminal"
+    fi
+    run bash -c "(sleep 1; printf 'menuconfig'; sleep 0.3; printf '\r'; sleep 1; printf 'Ada\r'; sleep 1; printf '\r'; sleep 0.5; printf '\033'; sleep 0.3) | script -qec \"stty cols 200 rows 30; bash '$SHELL_BUN' --no-trust-check '$TEST_CONFIG'\" /dev/null"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "hello Ada" ]]
+    [[ "$output" =~ "Failed: Kernel - menuconfig" ]]
+    run cat "$LOG_DIR"/*_Kernel_menuconfig.log
+    [ "${lines[0]}" = "Name? Ada" ]
+    [ "${lines[1]}" = "hello Ada" ]
+    [ "${lines[2]}" = "on a terminal" ]
+    [[ "$output" =~ "[shell-bun] Finished with exit code 4 " ]]
+    [[ ! "$output" =~ "Script started" ]]
+}
+
+@test "In a batch, actions that need the terminal run after the others" {
+    if ! script -qec true /dev/null >/dev/null 2>&1; then
+        skip "util-linux 'script' is required to emulate a terminal"
+    fi
+    run bash -c "(sleep 1; printf '+'; sleep 0.3; printf '\r'; sleep 2.5; printf 'Ada\r'; sleep 1.5; printf 'q'; sleep 0.5; printf '\033'; sleep 0.3) | script -qec \"stty cols 200 rows 30; bash '$SHELL_BUN' --no-trust-check '$TEST_CONFIG'\" /dev/null"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Executing Kernel - menuconfig attached to the terminal..." ]]
+    [[ "$output" =~ "hello Ada" ]]
+    [[ "$output" =~ "FAILED: Kernel - menuconfig" ]]
+    [[ "$output" =~ "SUCCESS: Kernel - build" ]]
+    grep -q "building" "$LOG_DIR"/*_Kernel_build.log
+}
@@ -0,0 +1,106 @@
+#!/usr/bin/env bats
+
+# Test JSON configs (.json, or --config-format json) and --dump-config, which
+# prints the config as read as a JSON config
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    WORK_DIR="$BATS_TEST_TMPDIR/work"
+    mkdir -p "$WORK_DIR"
+
+    cat > "$BATS_TEST_TMPDIR/same.cfg" << EOF
+var_ROOT=$WORK_DIR
+log_dir=\${ROOT}/logs
+env_MODE=release
+
+[Web]
+working_dir=\${ROOT}
+shell=bash
+env_PORT=8080
+build=echo "web: built" # kept
+test=npm test
+test.depends_on=build,lint
+lint=echo lint
+
+[Api]
+build=make
+build.retries=2
+deploy=./deploy.sh 'prod'
+EOF
+}
+
+# Function to run shell-bun.sh and print its output without the config file name and times
+run_normalized() {
+    bash "$SHELL_BUN" --no-trust-check "$@" 2>&1 | sed -e 's/same\.\(cfg\|json\)/CONFIG/g' -e 's/ ([0-9]*m\?s)//' -e '/^Total time: /d'
+}
+
+@test "JSON: --dump-config prints a JSON config that runs the same commands" {
+    run bash -c "bash '$SHELL_BUN' --no-trust-check --dump-config '$BATS_TEST_TMPDIR/same.cfg' 2>/dev/null"
+    [ "$status" -eq 0 ]
+    echo "$output" > "$BATS_TEST_TMPDIR/same.json"
+    [[ "$output" =~ '"name": "Web"' ]]
+    [[ "$output" =~ '"build": "echo \"web: built\" # kept"' ]]
+    [[ "$output" =~ '"test.depends_on": "build,lint"' ]]
+    # ${...} values are expanded
+    [[ "$output" =~ "\"log_dir\": \"$WORK_DIR/logs\"" ]]
+    if command -v python3 >/dev/null 2>&1; then
+        python3 -m json.tool "$BATS_TEST_TMPDIR/same.json" > /dev/null
+    fi
+
+    run run_normalized --ci "*" "*" --dry-run --sequential "$BATS_TEST_TMPDIR/same.cfg"
+    local ini="$output"
+    run run_normalized --ci "*" "*" --dry-run --sequential "$BATS_TEST_TMPDIR/same.json"
+    [ "$output" == "$ini" ]
+
+    # Dumping the JSON config again gives the same JSON
+    run bash -c "bash '$SHELL_BUN' --no-trust-check --dump-config '$BATS_TEST_TMPDIR/same.json' 2>/dev/null"
+    [ "$output" == "$(cat "$BATS_TEST_TMPDIR/same.json")" ]
+}
+
+@test "JSON: --dump-config reads includes and YAML configs in place" {
+    mkdir -p "$BATS_TEST_TMPDIR/team"
+    printf 'log_dir=logs\n[Team]\nbuild=echo team\n' > "$BATS_TEST_TMPDIR/team/team.cfg"
+    printf 'include=team/team.cfg\n[Top]\nbuild=echo top\n' > "$BATS_TEST_TMPDIR/main.cfg"
+    run bash -c "bash '$SHELL_BUN' --no-trust-check --dump-config '$BATS_TEST_TMPDIR/main.cfg' 2>/dev/null"
+    [ "$status" -eq 0 ]
+    [[ ! "$output" =~ "include" ]]
+    [[ "$output" =~ "\"log_dir\": \"$BATS_TEST_TMPDIR/team/logs\"" ]]
+    [[ "$output" =~ '"name": "Team"' ]]
+    [[ "$output" =~ '"name": "Top"' ]]
+
+    printf 'apps:\n  - name: Yaml\n    actions:\n      build: |\n        make\n        make install\n' > "$BATS_TEST_TMPDIR/app.yaml"
+    run bash -c "bash '$SHELL_BUN' --no-trust-check --dump-config '$BATS_TEST_TMPDIR/app.yaml' 2>/dev/null"
+    [[ "$output" =~ '"build": "make\nmake install"' ]]
+
+    # Multi-line commands are dumped as written, so the dump loads the same config
+    echo "$output" > "$BATS_TEST_TMPDIR/app.json"
+    run bash -c "bash '$SHELL_BUN' --no-trust-check --dump-config '$BATS_TEST_TMPDIR/app.json' 2>/dev/null"
+    [ "$status" -eq 0 ]
+    [ "$output" == "$(cat "$BATS_TEST_TMPDIR/app.json")" ]
+}
+
+@test "JSON: --config-format json, null values and line breaks in commands" {
+    printf '{"apps": [{"name": "A", "actions": {"test": "echo one\\necho two", "lint": null}}]}' > "$BATS_TEST_TMPDIR/config.txt"
+    run bash "$SHELL_BUN" --no-trust-check --config-format json --ci A test "$BATS_TEST_TMPDIR/config.txt"
+    [ "$status" -eq 0 ]
+    echo "$output" | grep -qx "one"
+    echo "$output" | grep -qx "two"
+}
+
+@test "JSON: syntax errors are reported with their line" {
+    printf '{\n  "log_dir": "/tmp/x",\n  "apps": [\n    {"name": "A", "actions": {"build": "make",}}\n  ]\n}\n' > "$BATS_TEST_TMPDIR/comma.json"
+    run bash "$SHELL_BUN" --no-trust-check --validate "$BATS_TEST_TMPDIR/comma.json"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "Ignoring the rest of the file from line 4: unexpected '}' ($BATS_TEST_TMPDIR/comma.json:4)" ]]
+
+    printf '{\n  "apps": [{"name": "A", "actions": {"build": make}}]\n}\n' > "$BATS_TEST_TMPDIR/bare.json"
+    run bash "$SHELL_BUN" --no-trust-check --validate "$BATS_TEST_TMPDIR/bare.json"
+    [[ "$output" =~ "unexpected 'make}}]' ($BATS_TEST_TMPDIR/bare.json:2)" ]]
+
+    printf '{\n  "apps": [\n    {"name": "A", "actions": {"build": "make"}}\n' > "$BATS_TEST_TMPDIR/open.json"
+    run bash "$SHELL_BUN" --no-trust-check --validate "$BATS_TEST_TMPDIR/open.json"
+    [[ "$output" =~ "the JSON ends before its last object or array is closed ($BATS_TEST_TMPDIR/open.json:3)" ]]
+}
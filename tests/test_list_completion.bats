@@ -0,0 +1,128 @@
+#!/usr/bin/env bats
+
+# Test --list and the shell completion scripts (completion bash|zsh|fish)
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_CONFIG="$BATS_TEST_TMPDIR/list.cfg"
+
+    cat > "$TEST_CONFIG" << 'EOF'
+[Web App]
+build=echo "web build"
+test=echo "web test"
+
+[API]
+build=echo "api build"
+deploy=echo "api deploy"
+lint=echo "api lint"
+EOF
+}
+
+@test "--list prints the apps one per line" {
+    run bash -c "bash '$SHELL_BUN' --list '$TEST_CONFIG' 2>/dev/null"
+    [ "$status" -eq 0 ]
+    [ "$output" = $'Web App\nAPI' ]
+}
+
+@test "--list with a pattern prints app<TAB>action without Show Details" {
+    run bash -c "bash '$SHELL_BUN' --list '*' '$TEST_CONFIG' 2>/dev/null"
+    [ "$status" -eq 0 ]
+    [ "$output" = $'Web App\tbuild\nWeb App\ttest\nAPI\tbuild\nAPI\tdeploy\nAPI\tlint' ]
+    [[ ! "$output" =~ "Show Details" ]]
+}
+
+@test "--list uses the same patterns as --ci" {
+    run bash -c "bash '$SHELL_BUN' --list 'api' '$TEST_CONFIG' 2>/dev/null | cut -f2"
+    [ "$status" -eq 0 ]
+    [ "$output" = $'build\ndeploy\nlint' ]
+}
+
+@test "--list and --ci take a YAML, TOML or JSON config right after them" {
+    printf 'apps:\n  - name: API\n    actions:\n      build: echo "api build"\n' > "$BATS_TEST_TMPDIR/list.yml"
+    printf '[[apps]]\nname = "API"\n[apps.actions]\nbuild = "echo api build"\n' > "$BATS_TEST_TMPDIR/list.toml"
+    printf '{"apps": [{"name": "API", "actions": {"build": "echo api build"}}]}' > "$BATS_TEST_TMPDIR/List.JSON"
+    local config
+    for config in list.yml list.toml List.JSON; do
+        run bash -c "bash '$SHELL_BUN' --list '$BATS_TEST_TMPDIR/$config' 2>/dev/null"
+        [ "$status" -eq 0 ]
+        [ "$output" = "API" ]
+
+        # The config is not taken for the action pattern
+        run bash "$SHELL_BUN" --ci API "$BATS_TEST_TMPDIR/$config"
+        [ "$status" -eq 1 ]
+        [[ "$output" =~ "Loading configuration from: $BATS_TEST_TMPDIR/$config" ]]
+        [[ "$output" =~ "Error: Action(s) required for CI mode" ]]
+    done
+}
+
+@test "--list reports patterns that match no app" {
+    run bash "$SHELL_BUN" --list Mobile "$TEST_CONFIG"
+    [ "$status" -eq 3 ]
+    [[ "$output" =~ "Error: No applications match 'Mobile'" ]]
+}
+
+@test "Bash completion completes app names after --ci" {
+    source <(bash "$SHELL_BUN" completion bash)
+    COMP_WORDS=("$SHELL_BUN" "$TEST_CONFIG" --ci W)
+    COMP_CWORD=3
+    _shell_bun
+    [ "${COMPREPLY[*]}" = 'Web\ App' ]
+}
+
+@test "Bash completion completes the last action of a list" {
+    source <(bash "$SHELL_BUN" completion bash)
+    COMP_WORDS=("$SHELL_BUN" "$TEST_CONFIG" --ci API build,d)
+    COMP_CWORD=4
+    _shell_bun
+    [ "${COMPREPLY[*]}" = "build,deploy" ]
+}
+
+@test "Bash completion reads app names from YAML, TOML and JSON configs, also in paths with spaces" {
+    mkdir -p "$BATS_TEST_TMPDIR/my configs"
+    local config="$BATS_TEST_TMPDIR/my configs/list.yaml"
+    printf 'apps:\n  - name: Mobile\n    actions:\n      build: echo mobile\n' > "$config"
+    source <(bash "$SHELL_BUN" completion bash)
+    COMP_WORDS=("$SHELL_BUN" "$config" --ci M)
+    COMP_CWORD=3
+    _shell_bun
+    [ "${COMPREPLY[*]}" = "Mobile" ]
+}
+
+@test "Bash completion offers config files of every supported format" {
+    mkdir -p "$BATS_TEST_TMPDIR/files/configs"
+    cd "$BATS_TEST_TMPDIR/files"
+    touch a.cfg b.yaml c.yml d.toml e.json f.txt
+    source <(bash "$SHELL_BUN" completion bash)
+    COMP_WORDS=("$SHELL_BUN" "")
+    COMP_CWORD=1
+    _shell_bun
+    [ "$(printf '%s\n' "${COMPREPLY[@]}" | LC_ALL=C sort | tr '\n' ' ')" = "a.cfg b.yaml c.yml configs d.toml e.json " ]
+}
+
+@test "Bash completion completes options" {
+    source <(bash "$SHELL_BUN" completion bash)
+    COMP_WORDS=("$SHELL_BUN" --no-d)
+    COMP_CWORD=1
+    _shell_bun
+    [ "${COMPREPLY[*]}" = "--no-discover" ]
+}
+
+@test "zsh and fish completion scripts call back into --list" {
+    run bash "$SHELL_BUN" completion zsh
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "#compdef shell-bun.sh" ]]
+    [[ "$output" =~ "--list" ]]
+    run bash "$SHELL_BUN" completion fish
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "complete -c shell-bun.sh" ]]
+    [[ "$output" =~ "--list" ]]
+}
+
+@test "completion requires a supported shell" {
+    run bash "$SHELL_BUN" completion tcsh
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "completion requires one of: bash, zsh, fish" ]]
+}
@@ -0,0 +1,70 @@
+#!/usr/bin/env bats
+
+# Test runs whose log directory cannot be written to (log_fallback)
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_CONFIG="$BATS_TEST_TMPDIR/fallback.cfg"
+    # A path below a file can never be created, even by root
+    touch "$BATS_TEST_TMPDIR/file"
+    LOG_DIR="$BATS_TEST_TMPDIR/file/logs"
+    export TMPDIR="$BATS_TEST_TMPDIR/tmp"
+    mkdir -p "$TMPDIR"
+    MARKER="$BATS_TEST_TMPDIR/ran"
+
+    cat > "$TEST_CONFIG" << EOF
+log_dir=$LOG_DIR
+
+[Portal]
+build=echo "Building Portal"; touch '$MARKER'
+test=echo "Testing Portal"
+EOF
+}
+
+# Select every action, run them and leave the log viewer and the menu
+run_batch() {
+    if ! script -qec true /dev/null >/dev/null 2>&1; then
+        skip "util-linux 'script' is required to emulate a terminal"
+    fi
+    run bash -c "(sleep 1; printf '+'; sleep 0.3; printf '\r'; sleep 3; printf 'q'; sleep 0.3; printf '\033'; sleep 0.3) | script -qec \"stty rows 30 cols 200; bash '$SHELL_BUN' --no-trust-check '$TEST_CONFIG'\" /dev/null"
+}
+
+@test "Logs go to a temporary directory when the log directory cannot be written to" {
+    run_batch
+    [ "$status" -eq 0 ]
+    local fallback_dir="$TMPDIR/shell-bun-logs-$(id -u)"
+    [[ "$output" =~ "Log directory $LOG_DIR cannot be created ($BATS_TEST_TMPDIR/file is not a directory): logs go to $fallback_dir instead" ]]
+    [[ "$output" =~ "SUCCESS: Portal - build ($fallback_dir/" ]]
+    [[ "$output" =~ "logs were written to $fallback_dir instead (log_fallback=tempdir)" ]]
+    [ "$(find "$fallback_dir" -name '*_Portal_build.log' | wc -l)" -eq 1 ]
+    grep -q "Building Portal" "$fallback_dir"/*_Portal_build.log
+}
+
+@test "log_fallback=disable runs actions without logs" {
+    sed -i '1a log_fallback=disable' "$TEST_CONFIG"
+    run_batch
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "SUCCESS: Portal - build (/dev/null)" ]]
+    [[ "$output" =~ "no logs were kept (log_fallback=disable)" ]]
+    [ -e "$MARKER" ]
+}
+
+@test "log_fallback=fail fails actions without running them" {
+    sed -i '1a log_fallback=fail' "$TEST_CONFIG"
+    run_batch
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "FAILED: Portal - build ($LOG_DIR/" ]]
+    [[ "$output" =~ "its actions were not run (log_fallback=fail)" ]]
+    [ ! -e "$MARKER" ]
+}
+
+@test "--validate reports unwritable log directories and invalid log_fallback values" {
+    sed -i '1a log_fallback=sometimes' "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --validate "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "Ignoring invalid log_fallback 'sometimes' (expected tempdir, disable or fail)" ]]
+    [[ "$output" =~ "Error: log_dir: $LOG_DIR cannot be created ($BATS_TEST_TMPDIR/file is not a directory); logs go to $TMPDIR/shell-bun-logs-$(id -u) instead (log_fallback=tempdir) ($TEST_CONFIG:1)" ]]
+}
@@ -0,0 +1,212 @@
+#!/usr/bin/env bats
+
+# Test log retention (max_logs, log_max_age, --clean-logs and --gc-logs)
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_CONFIG="$BATS_TEST_TMPDIR/retention.cfg"
+    LOG_DIR="$BATS_TEST_TMPDIR/logs"
+    mkdir -p "$LOG_DIR"
+}
+
+# Create a log of an action (or a batch log) last modified the given number of days ago
+make_log() {
+    local name="$1"
+    local days="$2"
+    local stamp
+    stamp=$(date -d "-$days days" '+%Y%m%d_%H%M%S')
+    local file="$LOG_DIR/${stamp}_$name.log"
+    echo "output" > "$file"
+    touch -d "-$days days" "$file"
+    echo "$file"
+}
+
+@test "--clean-logs keeps the newest max_logs logs of each action" {
+    cat > "$TEST_CONFIG" << EOF
+log_dir=$LOG_DIR
+max_logs=2
+
+[Portal]
+build=echo "Building Portal"
+test=echo "Testing Portal"
+EOF
+    local oldest
+    oldest=$(make_log Portal_build 3)
+    echo "note" > "$oldest.note"
+    echo "started=1" > "$oldest.phases"
+    make_log Portal_build 2
+    make_log Portal_build 1
+    make_log Portal_test 3
+    # Other apps whose names end in the same words are not counted
+    make_log My_Portal_build 4
+
+    run bash "$SHELL_BUN" --clean-logs "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Deleted $oldest" ]]
+    [[ "$output" =~ "Deleted 1 log file(s)" ]]
+    [ ! -e "$oldest" ]
+    [ ! -e "$oldest.note" ]
+    [ ! -e "$oldest.phases" ]
+    [ "$(find "$LOG_DIR" -name '*_Portal_build.log' | wc -l)" -eq 3 ]
+    [ "$(find "$LOG_DIR" -name '*_Portal_test.log' | wc -l)" -eq 1 ]
+}
+
+@test "log_max_age deletes older logs independently of max_logs, and apps can override both" {
+    cat > "$TEST_CONFIG" << EOF
+log_dir=$LOG_DIR
+log_max_age=7d
+
+[Portal]
+build=echo "Building Portal"
+
+[API]
+log_max_age=1d
+max_logs=5
+build=echo "Building API"
+EOF
+    local old_portal recent_portal old_api old_batch
+    old_portal=$(make_log Portal_build 10)
+    recent_portal=$(make_log Portal_build 5)
+    old_api=$(make_log API_build 2)
+    make_log API_build 0
+    old_batch=$(make_log batch 8)
+
+    run bash "$SHELL_BUN" --clean-logs "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Deleted 3 log file(s)" ]]
+    [ ! -e "$old_portal" ]
+    [ -e "$recent_portal" ]
+    [ ! -e "$old_api" ]
+    [ ! -e "$old_batch" ]
+    [ "$(find "$LOG_DIR" -name '*_API_build.log' | wc -l)" -eq 1 ]
+}
+
+@test "--clean-logs without a retention setting deletes nothing" {
+    cat > "$TEST_CONFIG" << EOF
+log_dir=$LOG_DIR
+
+[Portal]
+build=echo "Building Portal"
+EOF
+    make_log Portal_build 30
+    run bash "$SHELL_BUN" --clean-logs "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "No max_logs or log_max_age set in $TEST_CONFIG; no logs deleted" ]]
+    [ "$(find "$LOG_DIR" -name '*.log' | wc -l)" -eq 1 ]
+}
+
+@test "Invalid max_logs and log_max_age values are reported" {
+    cat > "$TEST_CONFIG" << EOF
+max_logs=many
+
+[Portal]
+log_max_age=a week
+build=echo "Building Portal"
+EOF
+    run bash "$SHELL_BUN" --validate "$TEST_CONFIG"
+    [[ "$output" =~ "Ignoring invalid max_logs 'many' (expected a number of logs, 0 for no limit)" ]]
+    [[ "$output" =~ "Ignoring invalid log_max_age 'a week' in [Portal] (expected a duration like 7d, 12h or 30m)" ]]
+}
+
+@test "Running an action deletes its oldest logs beyond max_logs" {
+    if ! script -qec true /dev/null >/dev/null 2>&1; then
+        skip "util-linux 'script' is required to emulate a terminal"
+    fi
+    cat > "$TEST_CONFIG" << EOF
+log_dir=$LOG_DIR
+
+[Portal]
+max_logs=2
+build=echo "Building Portal"
+EOF
+    local oldest second
+    oldest=$(make_log Portal_build 2)
+    second=$(make_log Portal_build 1)
+
+    # Run Portal - build from the action menu, then leave the log viewer and the menu
+    run bash -c "(sleep 1; printf '\r'; sleep 0.5; printf '\r'; sleep 3; printf 'q'; sleep 0.3; printf '\033'; sleep 0.3) | script -qec \"stty rows 30 cols 200; bash '$SHELL_BUN' --no-trust-check '$TEST_CONFIG'\" /dev/null"
+    [ ! -e "$oldest" ]
+    [ -e "$second" ]
+    [ "$(find "$LOG_DIR" -name '*_Portal_build.log' | wc -l)" -eq 2 ]
+}
+
+@test "--gc-logs --dry-run lists orphaned logs and empty directories without deleting them" {
+    cat > "$TEST_CONFIG" << EOF
+log_dir=$LOG_DIR
+log_max_age=7d
+log_gc_orphans=true
+
+[Portal]
+log_dir=$LOG_DIR/Portal
+build=echo "Building Portal"
+EOF
+    mkdir -p "$LOG_DIR/Portal" "$LOG_DIR/Renamed/old"
+    local old_renamed recent_renamed old_portal
+    old_renamed=$(make_log Renamed_build 10)
+    echo "note" > "$old_renamed.note"
+    recent_renamed=$(make_log Renamed_build 1)
+    old_portal=$(LOG_DIR="$LOG_DIR/Portal" make_log Portal_build 10)
+
+    run bash "$SHELL_BUN" --gc-logs --dry-run "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Would delete $old_renamed" ]]
+    [[ "$output" =~ "Would delete $old_portal" ]]
+    [[ ! "$output" =~ "$recent_renamed" ]]
+    # Directories left empty by the deletions are listed too
+    [[ "$output" =~ "Would delete empty directory $LOG_DIR/Portal" ]]
+    [[ "$output" =~ "Would delete empty directory $LOG_DIR/Renamed/old" ]]
+    [[ "$output" =~ "would delete 2 log file(s) and 3 empty directories, freeing 19 B" ]]
+    [ -e "$old_renamed" ]
+    [ -d "$LOG_DIR/Renamed/old" ]
+
+    run bash "$SHELL_BUN" --gc-logs "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Deleted 2 log file(s) and 3 empty directories, freeing 19 B" ]]
+    [ ! -e "$old_renamed" ]
+    [ ! -e "$old_renamed.note" ]
+    [ -e "$recent_renamed" ]
+    [ ! -e "$LOG_DIR/Portal" ]
+    [ ! -e "$LOG_DIR/Renamed" ]
+    [ -d "$LOG_DIR" ]
+}
+
+@test "--gc-logs keeps logs of removed apps without log_gc_orphans and stays inside the log directories" {
+    cat > "$TEST_CONFIG" << EOF
+log_dir=$LOG_DIR
+log_max_age=7d
+
+[Portal]
+build=echo "Building Portal"
+EOF
+    mkdir -p "$BATS_TEST_TMPDIR/outside/empty"
+    local old_renamed
+    old_renamed=$(make_log Renamed_build 10)
+
+    run bash "$SHELL_BUN" --gc-logs "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Deleted 0 log file(s) and 0 empty directories, freeing 0 B" ]]
+    [ -e "$old_renamed" ]
+    [ -d "$BATS_TEST_TMPDIR/outside/empty" ]
+}
+
+@test "log_gc cleans up the log directories at startup" {
+    cat > "$TEST_CONFIG" << EOF
+log_dir=$LOG_DIR
+max_logs=1
+log_gc=true
+
+[Portal]
+build=echo "Building Portal"
+EOF
+    mkdir -p "$LOG_DIR/empty"
+    make_log Portal_build 2
+    make_log Portal_build 1
+
+    run bash "$SHELL_BUN" --ci Portal build "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Deleted 1 log file(s) and 1 empty directory, freeing 7 B" ]]
+    [ ! -e "$LOG_DIR/empty" ]
+}
@@ -0,0 +1,53 @@
+#!/usr/bin/env bats
+
+# Test searching logs from the log viewer (/)
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_CONFIG="$BATS_TEST_TMPDIR/search.cfg"
+    LOG_DIR="$BATS_TEST_TMPDIR/logs"
+
+    # The interactive UI needs a terminal; util-linux 'script' provides one
+    if ! script -qec true /dev/null >/dev/null 2>&1; then
+        skip "util-linux 'script' is required to emulate a terminal"
+    fi
+    if ! command -v less >/dev/null 2>&1; then
+        skip "less is required to view logs"
+    fi
+
+    cat > "$TEST_CONFIG" << EOF
+log_dir=$LOG_DIR
+
+[Portal]
+build=echo "Error: first"; echo "all good"; echo "ERROR: second"
+EOF
+}
+
+# Select every action, run them, then search the highlighted log for the given text
+run_search() {
+    local query="$1"
+    run bash -c "(sleep 1; printf '+'; sleep 0.3; printf '\r'; sleep 2; printf '/'; sleep 0.3; printf '%s\r' '$query'; sleep 0.5; printf 'q'; sleep 0.3; printf 'q'; sleep 0.3; printf '\033'; sleep 0.3) | script -qec \"stty rows 30 cols 200; bash '$SHELL_BUN' '$TEST_CONFIG'\" /dev/null"
+}
+
+@test "/ opens the log at the first match and counts matching lines, ignoring case" {
+    run_search 'error'
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Search "[0-9_]+"_Portal_build.log (start with \\c to match case): /" ]]
+    [[ "$output" =~ "2 matching line(s) for error - n/N: next/previous match, ESC-u: hide highlights, q: back" ]]
+}
+
+@test "A search starting with \c matches case" {
+    run_search '\cERROR'
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "1 matching line(s) for ERROR" ]]
+}
+
+@test "A search without matches does not open the log" {
+    run_search 'missing'
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "No lines match 'missing' in "[0-9_]+"_Portal_build.log" ]]
+    [[ ! "$output" =~ "matching line(s)" ]]
+}
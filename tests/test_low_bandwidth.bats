@@ -0,0 +1,78 @@
+#!/usr/bin/env bats
+
+# Test the low-bandwidth mode for slow terminals (--low-bandwidth, Ctrl+B)
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_CONFIG="$BATS_TEST_TMPDIR/low.cfg"
+    LOG_DIR="$BATS_TEST_TMPDIR/logs"
+
+    # The interactive UI needs a terminal; util-linux 'script' provides one
+    if ! script -qec true /dev/null >/dev/null 2>&1; then
+        skip "util-linux 'script' is required to emulate a terminal"
+    fi
+
+    cat > "$TEST_CONFIG" << EOF
+log_dir=$LOG_DIR
+
+[WebApp]
+build=echo built
+wait=sleep 2
+
+[ApiServer]
+build=echo built
+EOF
+}
+
+# Feed the given keys to the menu started with the given options, then quit
+run_menu_with_keys() {
+    local keys="$1"
+    local options="${2:-}"
+    run bash -c "(sleep 1; printf '$keys'; sleep 1; printf '\033'; sleep 0.3) | script -qec \"stty cols 200; bash '$SHELL_BUN' $options '$TEST_CONFIG'\" /dev/null"
+}
+
+@test "--low-bandwidth shows a plainer menu and says so in the status line" {
+    run_menu_with_keys '' --low-bandwidth
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Selected: none | Low bandwidth" ]]
+    [[ "$output" =~ "Ctrl+B: full view" ]]
+    [[ ! "$output" =~ "Shell-Bun by Fredrik Reveny" ]]
+    [[ ! "$output" =~ "Shortcuts:" ]]
+}
+
+@test "Ctrl+B switches low bandwidth on and off" {
+    run_menu_with_keys '\002'
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Ctrl+B: low bandwidth" ]]
+    [[ "$output" =~ "Selected: none | Low bandwidth" ]]
+
+    run_menu_with_keys '\002' --low-bandwidth
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Shell-Bun by Fredrik Reveny" ]]
+}
+
+@test "Switching keeps the filter and the highlighted item" {
+    run_menu_with_keys 'api\002' --low-bandwidth
+    [ "$status" -eq 0 ]
+    local rebuilt="${output##*Shell-Bun by Fredrik Reveny}"
+    [[ "$rebuilt" =~ "Filter: api" ]]
+    [[ "$rebuilt" =~ "Server - build" ]]
+    [[ ! "$rebuilt" =~ "WebApp - build" ]]
+}
+
+@test "Slow redraws switch to low bandwidth" {
+    SHELL_BUN_SLOW_RENDER_MS=0 run_menu_with_keys '\033[B\033[B\033[B'
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Low bandwidth: redraws were slow (Ctrl+B: full view)" ]]
+}
+
+@test "The running view leaves out process IDs in low bandwidth" {
+    run bash -c "(sleep 1; printf '+'; sleep 0.3; printf '\r'; sleep 4; printf 'q'; sleep 0.5; printf '\033'; sleep 0.3) | script -qec \"stty cols 200; bash '$SHELL_BUN' --low-bandwidth '$TEST_CONFIG'\" /dev/null"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "still running | Low bandwidth" ]]
+    [[ "$output" =~ WebApp\ -\ wait\ \ [0-9]+s\ \ \[running\] ]]
+    [[ ! "$output" =~ "PGID" ]]
+}
@@ -0,0 +1,78 @@
+#!/usr/bin/env bats
+
+# Test the limit on actions running at the same time (max_parallel, --jobs)
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_CONFIG="$BATS_TEST_TMPDIR/parallel.cfg"
+    EVENTS="$BATS_TEST_TMPDIR/events"
+    LOG_DIR="$BATS_TEST_TMPDIR/logs"
+
+    cat > "$TEST_CONFIG" << EOF
+log_dir=$LOG_DIR
+max_parallel=2
+
+[Build]
+one=echo start >> "$EVENTS"; sleep 1; echo end >> "$EVENTS"
+two=echo start >> "$EVENTS"; sleep 1; echo end >> "$EVENTS"
+three=echo start >> "$EVENTS"; sleep 1; echo end >> "$EVENTS"
+four=echo start >> "$EVENTS"; sleep 1; echo end >> "$EVENTS"
+EOF
+}
+
+# Print the most actions that were running at the same time
+max_concurrent() {
+    awk '/start/ { running++ } /end/ { running-- } running > max { max = running } END { print max }' "$EVENTS"
+}
+
+@test "max_parallel caps the actions running at the same time" {
+    run bash "$SHELL_BUN" --ci Build all "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Running 4 action(s), max 2 in parallel..." ]]
+    [[ "$output" =~ "Successful operations: 4" ]]
+    [ "$(grep -c start "$EVENTS")" -eq 4 ]
+    [ "$(max_concurrent)" -eq 2 ]
+}
+
+@test "--jobs overrides max_parallel" {
+    run bash "$SHELL_BUN" --ci Build all --jobs 3 "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Running 4 action(s), max 3 in parallel..." ]]
+    [ "$(max_concurrent)" -eq 3 ]
+}
+
+@test "--jobs 0 starts every action at once" {
+    run bash "$SHELL_BUN" --ci Build all --jobs=0 "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Running 4 actions in parallel..." ]]
+    [ "$(max_concurrent)" -eq 4 ]
+}
+
+@test "Invalid limits are reported" {
+    sed -i 's/^max_parallel=2$/max_parallel=lots/' "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --ci Build one "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Ignoring invalid max_parallel 'lots' (expected a number)" ]]
+
+    run bash "$SHELL_BUN" --ci Build all --jobs many "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "--jobs requires a number" ]]
+
+    run bash "$SHELL_BUN" --ci Build all --jobs 2 --sequential "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "--sequential runs one action at a time and cannot be combined with --jobs" ]]
+}
+
+@test "Menu batches wait for a free slot in the running view" {
+    if ! script -qec true /dev/null >/dev/null 2>&1; then
+        skip "util-linux 'script' is required to emulate a terminal"
+    fi
+    run bash -c "(sleep 1; printf '+'; sleep 0.3; printf '\r'; sleep 3.5; printf 'q'; sleep 0.3; printf '\033'; sleep 0.3) | script -qec \"stty cols 200; bash '$SHELL_BUN' --no-trust-check '$TEST_CONFIG'\" /dev/null"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "2 still running, 2 waiting" ]]
+    [[ "$output" =~ "Successful: 4" ]]
+    [ "$(max_concurrent)" -eq 2 ]
+}
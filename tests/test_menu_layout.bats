@@ -0,0 +1,166 @@
+#!/usr/bin/env bats
+
+# Test the multi-column and split menu layouts on wide terminals
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_CONFIG="$BATS_TEST_TMPDIR/layout.cfg"
+
+    # The interactive UI needs a terminal; util-linux 'script' provides one
+    if ! script -qec true /dev/null >/dev/null 2>&1; then
+        skip "util-linux 'script' is required to emulate a terminal"
+    fi
+
+    cat > "$TEST_CONFIG" << 'EOF2'
+menu_columns=auto
+
+[AppOne]
+build=echo "one build"
+test=echo "one test"
+
+[AppTwo]
+build=echo "two build"
+EOF2
+}
+
+# Run the menu in a terminal of the given width (and height), feeding keys before quitting
+run_menu_with_keys() {
+    local columns="$1"
+    local keys="$2"
+    local rows="${3:-30}"
+    run bash -c "(sleep 1; printf '$keys'; sleep 0.5; printf '\033'; sleep 0.3) | script -qec \"stty cols $columns rows $rows; bash '$SHELL_BUN' --fresh '$TEST_CONFIG'\" /dev/null"
+}
+
+@test "Wide terminals lay items out in three columns" {
+    run_menu_with_keys 140 ''
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "AppOne - build"[^$'\n']*"AppOne - test"[^$'\n']*"AppOne - Show Details" ]]
+    [[ "$output" =~ "AppTwo - build"[^$'\n']*"AppTwo - Show Details" ]]
+    [[ "$output" =~ "↑/↓/←/→ arrows" ]]
+}
+
+@test "Narrow terminals collapse to a single column" {
+    run_menu_with_keys 50 ''
+    [ "$status" -eq 0 ]
+    [[ ! "$output" =~ "AppOne - build"[^$'\n']*"AppOne - test" ]]
+    [[ "$output" =~ "↑/↓ arrows |" ]]
+}
+
+@test "Right arrow moves the highlight to the next column and selection works per cell" {
+    run_menu_with_keys 140 '\033[C \033[B'
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "► AppOne - test [✓]" ]]
+    [[ "$output" =~ "Selected: 1 items" ]]
+    # Down from the middle column of a shorter last row lands on its last cell
+    [[ "$output" =~ "► AppTwo - Show Details" ]]
+}
+
+@test "menu_columns=1 keeps the single-column list" {
+    sed 's/^menu_columns=auto$/menu_columns=1/' "$TEST_CONFIG" > "$TEST_CONFIG.tmp"
+    mv "$TEST_CONFIG.tmp" "$TEST_CONFIG"
+    run_menu_with_keys 140 ''
+    [ "$status" -eq 0 ]
+    [[ ! "$output" =~ "AppOne - build"[^$'\n']*"AppOne - test" ]]
+}
+
+@test "Invalid menu_columns values are reported" {
+    sed 's/^menu_columns=auto$/menu_columns=wide/' "$TEST_CONFIG" > "$TEST_CONFIG.tmp"
+    mv "$TEST_CONFIG.tmp" "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --ci AppOne build "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Ignoring invalid menu_columns 'wide'" ]]
+}
+
+@test "Page Down moves a full page of grid rows" {
+    {
+        echo "menu_columns=3"
+        echo "[PageApp]"
+        for i in $(seq -w 1 30); do echo "a$i=echo $i"; done
+    } > "$TEST_CONFIG"
+    run bash -c "(sleep 1; printf '\033[6~'; sleep 0.5; printf '\033'; sleep 0.3) | script -qec \"stty cols 140 rows 14; bash '$SHELL_BUN' --fresh '$TEST_CONFIG'\" /dev/null"
+    [ "$status" -eq 0 ]
+    # 4 visible rows of 3 columns (the preview bar takes two lines): the highlight moves 12 items
+    [[ "$output" =~ "► PageApp - a13" ]]
+}
+
+@test "layout=split shows the command of the highlighted action beside the list" {
+    sed 's/^menu_columns=auto$/layout=split/' "$TEST_CONFIG" > "$TEST_CONFIG.tmp"
+    mv "$TEST_CONFIG.tmp" "$TEST_CONFIG"
+    run_menu_with_keys 150 '\033[B'
+    [ "$status" -eq 0 ]
+    # The pane starts after the left 40% of the terminal
+    [[ "$output" =~ $'\033'"[10;61H" ]]
+    local plain
+    plain=$(printf '%s' "$output" | sed $'s/\x1b\\[[0-9;]*[A-Za-z]//g')
+    [[ "$plain" =~ "► AppOne - test" ]]
+    [[ "$plain" =~ "│ Context: AppOne - test (Tab: scroll)" ]]
+    [[ "$plain" =~ "│ bash -c echo\ \\\"one\ test\\\"" ]]
+    [[ "$output" =~ "No runs yet in this session" ]]
+    [[ "$output" =~ "Tab: switch list/context pane" ]]
+}
+
+@test "The context pane shows the output of the action's last run and Tab focuses it" {
+    printf 'layout=split\nlog_dir=%s\n' "$BATS_TEST_TMPDIR/logs" | cat - "$TEST_CONFIG" > "$TEST_CONFIG.tmp"
+    mv "$TEST_CONFIG.tmp" "$TEST_CONFIG"
+    # Run AppOne - build, return to the menu and focus the pane
+    run bash -c "(sleep 1; printf '\r'; sleep 2; printf '\r'; sleep 1; printf '\t'; sleep 0.5; printf '\033'; sleep 0.3) | script -qec \"stty cols 150 rows 30; bash '$SHELL_BUN' --fresh '$TEST_CONFIG'\" /dev/null"
+    [ "$status" -eq 0 ]
+    local plain
+    plain=$(printf '%s' "$output" | sed $'s/\x1b\\[[0-9;]*[A-Za-z]//g')
+    [[ "$plain" =~ "│ Last run ($BATS_TEST_TMPDIR/logs/" ]]
+    [[ "$plain" =~ "│ one build" ]]
+    [[ "$output" =~ "Context: AppOne - build (↑/↓ PgUp/PgDn: scroll, Tab: back to the list)" ]]
+}
+
+@test "The split layout collapses on narrow terminals and | switches it" {
+    sed 's/^menu_columns=auto$/layout=split/' "$TEST_CONFIG" > "$TEST_CONFIG.tmp"
+    mv "$TEST_CONFIG.tmp" "$TEST_CONFIG"
+    run_menu_with_keys 80 ''
+    [ "$status" -eq 0 ]
+    [[ ! "$output" =~ "Context:" ]]
+
+    run bash -c "(sleep 1; printf '|'; sleep 0.5; printf '\033'; sleep 0.3) | script -qec \"stty cols 150 rows 30; bash '$SHELL_BUN' --fresh '$TEST_CONFIG'\" /dev/null"
+    [ "$status" -eq 0 ]
+    # The first frame is split, the one rebuilt after | is not
+    [[ "$output" =~ "Context:" ]]
+    [[ "${output##*Filter: }" != *"Context:"* ]]
+}
+
+@test "Invalid layout values are reported" {
+    sed 's/^menu_columns=auto$/layout=tiles/' "$TEST_CONFIG" > "$TEST_CONFIG.tmp"
+    mv "$TEST_CONFIG.tmp" "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --ci AppOne build "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Ignoring invalid layout 'tiles' (expected single or split)" ]]
+}
+
+@test "The preview bar shows the command and working dir of the highlighted item" {
+    run_menu_with_keys 50 '\033[B\033[B'
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Command: bash -c echo\ \\\"one\ build\\\"" ]]
+    [[ "$output" =~ "Command: bash -c echo\ \\\"one\ test\\\"" ]]
+    [[ "$output" =~ "Working dir: $SCRIPT_DIR" ]]
+    [[ "$output" =~ "AppOne: 2 action(s)" ]]
+    # Commands wider than the terminal are cut with an ellipsis
+    sed 's/^test=.*$/test=echo "a test command that does not fit in fifty columns"/' "$TEST_CONFIG" > "$TEST_CONFIG.tmp"
+    mv "$TEST_CONFIG.tmp" "$TEST_CONFIG"
+    run_menu_with_keys 50 '\033[B'
+    [[ "$output" =~ "Command: bash -c echo\ \\\"a\ test\ command\ that\ …" ]]
+}
+
+@test "The list leaves room for the preview bar" {
+    {
+        echo "[PageApp]"
+        for i in $(seq -w 1 30); do echo "a$i=echo $i"; done
+    } > "$TEST_CONFIG"
+    run_menu_with_keys 60 '' 20
+    [ "$status" -eq 0 ]
+    # 20 rows: title box, help and status lines, scroll indicators, preview bar and bottom line leave 6
+    [[ "$output" =~ "PageApp - a06" ]]
+    [[ ! "$output" =~ "PageApp - a07" ]]
+    [[ "$output" =~ "25 more item(s) below" ]]
+    [[ "$output" =~ $'\033'"[18;1H"$'\033'"[2K"[^$'\n']*"Command: bash -c echo\ 01" ]]
+}
@@ -0,0 +1,123 @@
+#!/usr/bin/env bats
+
+# Test the machine-readable reports of CI runs (--output json / junit)
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_CONFIG="$BATS_TEST_TMPDIR/report.cfg"
+
+    cat > "$TEST_CONFIG" << 'EOF'
+[Web]
+allow_failure=lint
+build=echo "building <web> & co"
+test=echo "2 tests failed"; exit 3
+lint=exit 1
+
+[Api]
+build=echo "api built"
+EOF
+}
+
+@test "--output json prints one result object per action on stdout only" {
+    run bash -c "bash '$SHELL_BUN' --ci Web,Api build,test --output json '$TEST_CONFIG' 2>/dev/null"
+    [ "$status" -eq 1 ]
+    [ "${lines[0]}" = "[" ]
+    [ "${lines[4]}" = "]" ]
+    [[ "${lines[1]}" =~ ^\ \ \{\"app\":\"Web\",\"action\":\"build\",\"command\":\"bash\ -c\ .*\",\"log_path\":null,\"success\":true,\"exit_code\":0,\"error\":null,\"timed_out\":false,\"allowed_to_fail\":false,\"started_at\":\"[0-9]{4}-[0-9]{2}-[0-9]{2}T[0-9:]{8}Z\",\"finished_at\":\"[0-9-]+T[0-9:]+Z\",\"duration\":[0-9]+,\"duration_ms\":[0-9]+,\"attempts\":1,\"retried_on\":null,\"category\":null,\"tags\":\[\]\},$ ]]
+    [[ "${lines[2]}" =~ \"app\":\"Web\",\"action\":\"test\",.*\"success\":false,\"exit_code\":3,\"error\":\"exit\ code\ 3\" ]]
+    [[ "${lines[3]}" =~ \"app\":\"Api\",\"action\":\"build\",.*\"success\":true ]]
+    [[ ! "$output" =~ "Starting:" ]]
+    [[ ! "$output" =~ "api built" ]]
+}
+
+@test "--output json measures durations in milliseconds" {
+    sed -i 's/^build=echo "building <web> \& co"$/build=sleep 0.3/' "$TEST_CONFIG"
+    run bash -c "bash '$SHELL_BUN' --ci Web build --output json '$TEST_CONFIG' 2>/dev/null"
+    [ "$status" -eq 0 ]
+    [[ "${lines[1]}" =~ \"duration_ms\":([0-9]+), ]]
+    [ "${BASH_REMATCH[1]}" -ge 300 ]
+}
+
+@test "--output keeps the progress output on stderr" {
+    run bash -c "bash '$SHELL_BUN' --ci Web build --output json '$TEST_CONFIG' 2>&1 >/dev/null"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Starting: Web - build" ]]
+    [[ "$output" =~ "building <web> & co" ]]
+    [[ ! "$output" =~ "\"app\"" ]]
+}
+
+@test "--output json marks allowed failures and actions that were not run" {
+    run bash -c "bash '$SHELL_BUN' --ci Web lint,test,build --sequential --output=json '$TEST_CONFIG' 2>/dev/null"
+    [ "$status" -eq 1 ]
+    [[ "${lines[1]}" =~ \"action\":\"lint\",.*\"exit_code\":1,\"error\":\"exit\ code\ 1\",\"timed_out\":false,\"allowed_to_fail\":true ]]
+    [[ "${lines[3]}" =~ \"action\":\"build\",.*\"success\":false,\"exit_code\":null,\"error\":\"not\ run:\ stopped\ after\ Web\ -\ test\ failed\",.*\"started_at\":null,\"finished_at\":null,\"duration\":0,\"duration_ms\":0,\"attempts\":0,\"retried_on\":null,\"category\":null,\"tags\":\[\]\}$ ]]
+}
+
+@test "--output json carries the failure category and the quality gate decision" {
+    sed -i '1i classify.tests=tests failed' "$TEST_CONFIG"
+    run bash -c "bash '$SHELL_BUN' --ci Web '*' --max-failures 1 --min-pass-rate 0.5 --output json '$TEST_CONFIG' 2>/dev/null"
+    [ "$status" -eq 0 ]
+    # The decision is reported once, next to the results
+    [ "${lines[0]}" = "{" ]
+    [ "${lines[1]}" = '  "quality_gate": {"passed":true,"counted":2,"failures":1,"max_failures":1,"pass_rate":0.5000,"min_pass_rate":0.5000},' ]
+    [ "${lines[2]}" = '  "results": [' ]
+    [[ "${lines[3]}" =~ ^\ \ \ \ \{\"app\":\"Web\",\"action\":\"build\",.*\"category\":null,\"tags\":\[\]\},$ ]]
+    [[ "${lines[4]}" =~ \"action\":\"test\",.*\"category\":\"tests\", ]]
+    [[ "${lines[5]}" =~ \"action\":\"lint\",.*\"category\":\"unknown\", ]]
+    [ "${lines[6]}" = "  ]" ]
+    [ "${lines[7]}" = "}" ]
+    [ "$(grep -c quality_gate <<< "$output")" -eq 1 ]
+
+    run bash -c "bash '$SHELL_BUN' --ci Web '*' --max-failures 0 --output json '$TEST_CONFIG' 2>/dev/null"
+    [ "$status" -eq 1 ]
+    [ "${lines[1]}" = '  "quality_gate": {"passed":false,"counted":2,"failures":1,"max_failures":0,"pass_rate":0.5000,"min_pass_rate":null},' ]
+}
+
+@test "--output junit prints a testsuite per app with escaped output" {
+    run bash -c "bash '$SHELL_BUN' --ci Web,Api build,test --output junit '$TEST_CONFIG' 2>/dev/null"
+    [ "$status" -eq 1 ]
+    [ "${lines[0]}" = '<?xml version="1.0" encoding="UTF-8"?>' ]
+    [[ "${lines[1]}" =~ ^\<testsuites\ name=\"shell-bun\"\ tests=\"3\"\ failures=\"1\"\ skipped=\"0\" ]]
+    [[ "$output" =~ '<testsuite name="Web" tests="2" failures="1" errors="0" skipped="0"' ]]
+    [[ "$output" =~ '<testsuite name="Api" tests="1" failures="0" errors="0" skipped="0"' ]]
+    [[ "$output" =~ '<system-out>building &lt;web&gt; &amp; co</system-out>' ]]
+    [[ "$output" =~ '<failure message="exit code 3" type="exit code 3"/>' ]]
+    [[ "$output" =~ "2 tests failed" ]]
+    [ "${lines[${#lines[@]}-1]}" = "</testsuites>" ]
+    # Times are in seconds with milliseconds
+    [[ "$output" =~ '<testcase classname="Web" name="build" time="'[0-9]+\.[0-9]{3}'">' ]]
+    if command -v xmllint >/dev/null 2>&1; then
+        echo "$output" | xmllint --noout -
+    fi
+}
+
+@test "--output junit gives failures the type of their category" {
+    sed -i '1i classify.tests=tests failed' "$TEST_CONFIG"
+    run bash -c "bash '$SHELL_BUN' --ci Web test,lint --output junit '$TEST_CONFIG' 2>/dev/null"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ '<failure message="exit code 3" type="tests"/>' ]]
+    [[ "$output" =~ '<failure message="exit code 1 (allowed to fail)" type="unknown"/>' ]]
+}
+
+@test "--output junit lists actions that were not run as skipped" {
+    run bash -c "bash '$SHELL_BUN' --ci Web test,build --sequential --output junit '$TEST_CONFIG' 2>/dev/null"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ '<testcase classname="Web" name="build" time="0.000">'$'\n''      <skipped message="not run: stopped after Web - test failed"/>' ]]
+}
+
+@test "--output requires CI mode, a known format and a single run" {
+    run bash "$SHELL_BUN" --ci Web build --output xml "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "--output requires a format: json or junit" ]]
+
+    run bash "$SHELL_BUN" --output json "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "--output requires --ci" ]]
+
+    run bash "$SHELL_BUN" --ci Web build --repeat 2 --output json "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "cannot be combined with --repeat or --explain" ]]
+}
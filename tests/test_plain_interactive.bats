@@ -0,0 +1,89 @@
+#!/usr/bin/env bats
+
+# Test the line-oriented menu for screen readers (--plain-interactive)
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_CONFIG="$BATS_TEST_TMPDIR/plain.cfg"
+
+    cat > "$TEST_CONFIG" << 'EOF'
+[Portal]
+build=echo "Building Portal"
+test=echo "Testing Portal"; exit 2
+
+[API]
+build=echo "Building API"
+EOF
+}
+
+# Expect-style session: wait for each prompt before answering it
+plain_session() {
+    local answer reply=""
+    mkfifo "$BATS_TEST_TMPDIR/input" "$BATS_TEST_TMPDIR/output"
+    bash "$SHELL_BUN" --plain-interactive --no-trust-check "$TEST_CONFIG" < "$BATS_TEST_TMPDIR/input" > "$BATS_TEST_TMPDIR/output" 2>&1 &
+    local pid=$!
+    exec 7> "$BATS_TEST_TMPDIR/input" 8< "$BATS_TEST_TMPDIR/output"
+    for answer in "$@"; do
+        while IFS= read -r -t 10 reply <&8; do
+            echo "$reply"
+            [[ "$reply" == "Enter action numbers"* ]] && break
+        done
+        [[ "$reply" == "Enter action numbers"* ]] || return 1
+        echo ">> $answer"
+        echo "$answer" >&7
+    done
+    exec 7>&-
+    while IFS= read -r -t 10 reply <&8; do
+        echo "$reply"
+    done
+    exec 8<&-
+    wait "$pid"
+}
+
+@test "Actions are listed by number and chosen by number and range" {
+    run plain_session "1" "2-3" "q"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "  1. Portal build"$'\n'"  2. Portal test"$'\n'"  3. API build" ]]
+    [[ "$output" =~ ">> 1"$'\n'">> Starting: Portal - build: "[^$'\n']*$'\n'"Building Portal" ]]
+    [[ "$output" =~ "Selection finished: all 1 action(s) succeeded." ]]
+    # 2-3 runs one at a time and stops at the failure, then the menu comes back
+    [[ "$output" =~ "Testing Portal" ]]
+    [[ ! "$output" =~ "Building API" ]]
+    [[ "$output" =~ "Selection finished with exit code 1."$'\n\n'"Actions:" ]]
+    [[ "$output" =~ "Goodbye!" ]]
+}
+
+@test "Patterns select actions as --ci does" {
+    run plain_session "* build" "q"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Building Portal" ]]
+    [[ "$output" =~ "Building API" ]]
+    [[ "$output" =~ "Selection finished: all 2 action(s) succeeded." ]]
+}
+
+@test "Invalid selections are explained and nothing is run" {
+    run plain_session "4" "Mobile build" "Portal deploy" "build" "q"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Error: '4' is not between 1 and 3. Nothing was run." ]]
+    [[ "$output" =~ "Error: no applications match 'Mobile'. Nothing was run." ]]
+    [[ "$output" =~ "Error: no actions of Portal match 'deploy'. Nothing was run." ]]
+    [[ "$output" =~ "Error: expected numbers or 'APP_PATTERN ACTION_PATTERN', got 'build'. Nothing was run." ]]
+    [[ ! "$output" =~ "Shell-Bun CI Mode" ]]
+}
+
+@test "The output has no escape sequences and the end of input quits" {
+    run bash -c "printf '1\n' | bash '$SHELL_BUN' --plain-interactive --no-trust-check '$TEST_CONFIG'"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Building Portal" ]]
+    [[ "$output" =~ "Goodbye!" ]]
+    [[ ! "$output" =~ $'\033' ]]
+}
+
+@test "--plain-interactive cannot be combined with --ci" {
+    run bash "$SHELL_BUN" --plain-interactive --no-trust-check --ci Portal build "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "Error: --plain-interactive reads its selections from stdin and cannot be combined with --ci" ]]
+}
@@ -0,0 +1,83 @@
+#!/usr/bin/env bats
+
+# Test the line editing of prompts: Tab completion of paths relative to the app's
+# working directory, history kept per config, and Ctrl+U in the menu filter
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_CONFIG="$BATS_TEST_TMPDIR/prompt.cfg"
+    STATE_DIR="$BATS_TEST_TMPDIR/state"
+    OUT_FILE="$BATS_TEST_TMPDIR/args.txt"
+    TREE="$BATS_TEST_TMPDIR/tree"
+    mkdir -p "$TREE/src/parser" "$TREE/docs"
+    touch "$TREE/src/parser/grammar.y" "$TREE/docs/index.md"
+
+    cat > "$TEST_CONFIG" << EOF
+log_dir=$BATS_TEST_TMPDIR/logs
+
+[App]
+working_dir=$TREE
+show=printf '[%s]' {{args...}} > "$OUT_FILE"
+EOF
+
+    if ! script -qec true /dev/null >/dev/null 2>&1; then
+        skip "util-linux 'script' is required to emulate a terminal"
+    fi
+}
+
+# Runs the show action from the menu, typing the given keys at its arguments prompt
+run_show_with() {
+    local keys="$1"
+    run bash -c "(sleep 1; printf 'show'; sleep 0.3; printf '\r'; sleep 0.5; printf '$keys'; sleep 0.3; printf '\r'; sleep 1; printf '\r'; sleep 0.3; printf '\033'; sleep 0.3) | script -qec \"stty cols 200 rows 30; bash '$SHELL_BUN' --no-trust-check --fresh --state-dir '$STATE_DIR' '$TEST_CONFIG'\" /dev/null"
+}
+
+@test "Tab completes paths relative to the app's working directory" {
+    cd "$BATS_TEST_TMPDIR"
+    run_show_with 'sr\t\tgr\t'
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Arguments for App - show:" ]]
+    [ "$(cat "$OUT_FILE")" = "[src/parser/grammar.y]" ]
+}
+
+@test "Tab completes directory names with a trailing slash" {
+    cd "$BATS_TEST_TMPDIR"
+    run_show_with 'do\t'
+    [ "$status" -eq 0 ]
+    [ "$(cat "$OUT_FILE")" = "[docs/]" ]
+}
+
+@test "Up recalls arguments typed in an earlier session" {
+    cd "$BATS_TEST_TMPDIR"
+    run_show_with 'first one'
+    [ "$(cat "$OUT_FILE")" = "[first][one]" ]
+    rm -f "$OUT_FILE"
+    run_show_with '\033[A'
+    [ "$status" -eq 0 ]
+    [ "$(cat "$OUT_FILE")" = "[first][one]" ]
+}
+
+@test "The history keeps each line once, newest last" {
+    cd "$BATS_TEST_TMPDIR"
+    run_show_with 'one'
+    run_show_with 'two'
+    run_show_with 'one'
+    local history_file
+    history_file=$(find "$STATE_DIR" -path '*prompt_history/args')
+    [ "$(tr '\n' ' ' < "$history_file")" = "two one " ]
+}
+
+@test "Ctrl+W and Ctrl+U edit the line" {
+    cd "$BATS_TEST_TMPDIR"
+    run_show_with 'wrong\025keep drop\027last'
+    [ "$status" -eq 0 ]
+    [ "$(cat "$OUT_FILE")" = "[keep][last]" ]
+}
+
+@test "Ctrl+U clears the menu filter" {
+    run bash -c "(sleep 1; printf 'nomatch'; sleep 0.3; printf '\025'; sleep 0.3; printf '\033'; sleep 0.3) | script -qec \"stty cols 200 rows 30; bash '$SHELL_BUN' --no-trust-check --fresh --state-dir '$STATE_DIR' '$TEST_CONFIG'\" /dev/null"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Filter: nomatch".*"Filter: (type to search)" ]]
+}
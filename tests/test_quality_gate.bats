@@ -0,0 +1,87 @@
+#!/usr/bin/env bats
+
+# Test the CI quality gate (--max-failures, --min-pass-rate, allow_failure)
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_CONFIG="$BATS_TEST_TMPDIR/farm.cfg"
+
+    cat > "$TEST_CONFIG" << 'EOF'
+[Farm]
+allow_failure=lint
+board1=echo "board1 ok"
+board2=echo "board2 broken"; exit 1
+board3=echo "board3 ok"
+board4=echo "board4 ok"
+lint=exit 1
+EOF
+}
+
+@test "Without thresholds any failure fails the run" {
+    run bash "$SHELL_BUN" --ci Farm board* "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [ "$(echo "$output" | grep -c "Quality gate")" -eq 0 ]
+}
+
+@test "--max-failures passes a run within the failure budget" {
+    run bash "$SHELL_BUN" --ci Farm board* --max-failures 1 "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "  - Farm - board2" ]]
+    [[ "$output" =~ "Failure budget: 1 of 1 allowed failure(s) used - within budget" ]]
+    [[ "$output" =~ "Result: passed" ]]
+}
+
+@test "--max-failures fails a run over the failure budget" {
+    run bash "$SHELL_BUN" --ci Farm board* --max-failures=0 "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "Failure budget: 1 of 0 allowed failure(s) used - over budget" ]]
+    [[ "$output" =~ "Result: failed" ]]
+}
+
+@test "--min-pass-rate accepts fractions and percentages" {
+    run bash "$SHELL_BUN" --ci Farm board* --min-pass-rate 0.75 "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Pass rate: 75.0% (3 of 4), required 75.0% - met" ]]
+
+    run bash "$SHELL_BUN" --ci Farm board* --min-pass-rate 80% "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "Pass rate: 75.0% (3 of 4), required 80.0% - not met" ]]
+}
+
+@test "allow_failure actions are listed but do not count against the gate" {
+    run bash "$SHELL_BUN" --ci Farm board1,lint "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "  - Farm - lint (allowed to fail)" ]]
+
+    run bash "$SHELL_BUN" --ci Farm all --max-failures 1 --min-pass-rate 0.75 "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Failure budget: 1 of 1 allowed failure(s) used" ]]
+    [[ "$output" =~ "Pass rate: 75.0% (3 of 4)" ]]
+}
+
+@test "Repeated runs count every iteration against the gate" {
+    run bash "$SHELL_BUN" --ci Farm board2 --repeat 3 --max-failures 2 "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "Failure budget: 3 of 2 allowed failure(s) used - over budget" ]]
+
+    run bash "$SHELL_BUN" --ci Farm board1 --repeat 3 --min-pass-rate 1 "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Pass rate: 100.0% (3 of 3), required 100.0% - met" ]]
+}
+
+@test "Invalid thresholds are rejected" {
+    run bash "$SHELL_BUN" --ci Farm all --min-pass-rate 1.5 "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "--min-pass-rate requires a rate between 0 and 1" ]]
+
+    run bash "$SHELL_BUN" --ci Farm all --max-failures few "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "--max-failures requires a number" ]]
+
+    run bash "$SHELL_BUN" --max-failures 2 "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "require --ci" ]]
+}
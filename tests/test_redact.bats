@@ -0,0 +1,110 @@
+#!/usr/bin/env bats
+
+# Test scrubbing the values of the redact variables from logs and output
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_CONFIG="$BATS_TEST_TMPDIR/redact.cfg"
+    export MY_TOKEN="s3cr3t-t0ken"
+    export API_KEY="k3y-123"
+
+    echo "log_dir=$BATS_TEST_TMPDIR/logs" > "$TEST_CONFIG"
+    cat >> "$TEST_CONFIG" << 'EOF'
+redact=MY_TOKEN, API_KEY
+
+[App]
+echo=echo "before $MY_TOKEN after"; echo "key=$API_KEY" >&2
+split=printf 'auth=s3cr'; sleep 0.3; printf '3t-t0'; sleep 0.3; printf 'ken;\n'
+tail=printf 'no newline %s' "$MY_TOKEN"
+EOF
+}
+
+@test "Values are scrubbed from CI output, also mid-line and on stderr" {
+    run bash "$SHELL_BUN" --ci App echo "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "before *** after" ]]
+    [[ "$output" =~ "key=***" ]]
+    [ "$(echo "$output" | grep -c -e "$MY_TOKEN" -e "$API_KEY")" -eq 0 ]
+}
+
+@test "A value written in several pieces is still scrubbed" {
+    run bash "$SHELL_BUN" --ci App split "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "auth=***;" ]]
+    [ "$(echo "$output" | grep -c "$MY_TOKEN")" -eq 0 ]
+}
+
+@test "A value in a last line without newline is scrubbed" {
+    run bash "$SHELL_BUN" --ci App tail "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "no newline ***" ]]
+    [ "$(echo "$output" | grep -c "$MY_TOKEN")" -eq 0 ]
+}
+
+@test "A value containing another one is replaced as a whole" {
+    export API_KEY="t0ken"
+    run bash "$SHELL_BUN" --ci App echo "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "before *** after" ]]
+    [ "$(echo "$output" | grep -c "s3cr3t-")" -eq 0 ]
+}
+
+@test "The full command and container command are scrubbed" {
+    run bash "$SHELL_BUN" --container "env TOKEN=$MY_TOKEN" --ci App echo "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Container mode enabled using CLI override: env TOKEN=***" ]]
+    [[ "$output" =~ "Starting: App - echo:" ]]
+    [ "$(echo "$output" | grep -c "$MY_TOKEN")" -eq 0 ]
+}
+
+@test "Values set by the config's env_ settings are scrubbed, also from the displayed command" {
+    unset MY_TOKEN
+    sed -i 's/^redact=.*/&, SPACED\nenv_MY_TOKEN=c0nf1g-t0ken/' "$TEST_CONFIG"
+    cat >> "$TEST_CONFIG" << 'EOF'
+env_SPACED=two words$
+show=echo "tok=$MY_TOKEN key=$API_KEY spaced=$SPACED"
+show.env.API_KEY=act10n-k3y
+EOF
+    run bash "$SHELL_BUN" --ci App show "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "tok=*** key=*** spaced=***" ]]
+    [[ "$output" =~ "Starting: App - show:" ]]
+    [ "$(echo "$output" | grep -c -e "c0nf1g-t0ken" -e "act10n-k3y" -e "two" -e "k3y-123")" -eq 0 ]
+
+    run bash "$SHELL_BUN" --ci App show --dry-run "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "[dry-run] cd " ]]
+    [ "$(echo "$output" | grep -c -e "c0nf1g-t0ken" -e "act10n-k3y" -e "two")" -eq 0 ]
+}
+
+@test "Log files of interactive runs are scrubbed" {
+    if ! script -qec true /dev/null >/dev/null 2>&1; then
+        skip "util-linux 'script' is required to emulate a terminal"
+    fi
+    cd "$BATS_TEST_TMPDIR"
+    run bash -c "(sleep 1; printf 'split'; sleep 0.3; printf '\r'; sleep 1.5; printf '\r'; sleep 0.3; printf '\033'; sleep 0.3) | script -qec \"stty cols 200; bash '$SHELL_BUN' '$TEST_CONFIG'\" /dev/null"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "auth=***;" ]]
+    [ "$(echo "$output" | grep -c "$MY_TOKEN")" -eq 0 ]
+    run cat "$BATS_TEST_TMPDIR"/logs/*_App_split.log
+    [[ "$output" =~ "auth=***;" ]]
+    [ "$(echo "$output" | grep -c "$MY_TOKEN")" -eq 0 ]
+}
+
+@test "Unset variables are ignored and invalid names are reported" {
+    unset MY_TOKEN
+    cat > "$TEST_CONFIG" << 'EOF'
+redact=MY_TOKEN, bad-name
+
+[App]
+echo=echo "plain"
+EOF
+    run bash "$SHELL_BUN" --ci App echo "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Ignoring invalid redact entry 'bad-name'" ]]
+    [[ "$output" =~ "plain" ]]
+    [ "$(echo "$output" | grep -c '\*\*\*')" -eq 0 ]
+}
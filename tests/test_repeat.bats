@@ -0,0 +1,95 @@
+#!/usr/bin/env bats
+
+# Test repeated runs for soak testing (--repeat and the '#' menu key)
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_CONFIG="$BATS_TEST_TMPDIR/repeat.cfg"
+    COUNTER="$BATS_TEST_TMPDIR/counter"
+
+    # 'flaky' fails on every second run
+    cat > "$TEST_CONFIG" << EOF
+log_dir=$BATS_TEST_TMPDIR/logs
+
+[Soak]
+steady=echo "steady run"
+flaky=echo x >> '$COUNTER'; [ \$((\$(wc -l < '$COUNTER') % 2)) -eq 1 ]
+slow=sleep 1; echo "slow run"
+EOF
+}
+
+@test "--repeat runs an action N times with an iteration index" {
+    run bash "$SHELL_BUN" --ci Soak steady --repeat 3 "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Repeating 1 action(s) 3 time(s), 1 iteration(s) at a time" ]]
+    [[ "$output" =~ "Completed: Soak - steady #1" ]]
+    [[ "$output" =~ "Completed: Soak - steady #3" ]]
+    [ "$(echo "$output" | grep -c "steady run")" -eq 3 ]
+    [[ "$output" =~ "Soak - steady: 3/3 passed (100%), min "[0-9]+"ms, avg "[0-9]+"ms, max "[0-9]+"ms" ]]
+}
+
+@test "--repeat summarises failed iterations and exits non-zero" {
+    run bash "$SHELL_BUN" --ci Soak flaky --repeat 4 "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "Failed: Soak - flaky #2" ]]
+    [[ "$output" =~ "Soak - flaky: 2/4 passed (50%)" ]]
+    [[ "$output" =~ "Failed iterations: 2, 4" ]]
+}
+
+@test "--repeat-parallel runs iterations in batches" {
+    local started=$SECONDS
+    run bash "$SHELL_BUN" --ci Soak slow --repeat 4 --repeat-parallel 4 "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "4 iteration(s) at a time" ]]
+    [[ "$output" =~ "Soak - slow: 4/4 passed (100%)" ]]
+    # Four 1 second iterations at once take far less than 4 seconds
+    [ $((SECONDS - started)) -lt 4 ]
+}
+
+@test "--repeat stops after the current iteration on SIGINT" {
+    # Job control keeps SIGINT from being ignored in the background job
+    set -m
+    bash "$SHELL_BUN" --ci Soak slow --repeat 5 "$TEST_CONFIG" > "$BATS_TEST_TMPDIR/out" 2>&1 &
+    local pid=$!
+    set +m
+    sleep 1.5
+    kill -INT "$pid"
+    local status=0
+    wait "$pid" || status=$?
+    [ "$status" -eq 130 ]
+    grep -q "stopping after the current iteration" "$BATS_TEST_TMPDIR/out"
+    grep -q "Completed: Soak - slow #2" "$BATS_TEST_TMPDIR/out"
+    grep -q "Stopped after 2 of 5 iteration(s)" "$BATS_TEST_TMPDIR/out"
+    grep -q "Soak - slow: 2/2 passed" "$BATS_TEST_TMPDIR/out"
+}
+
+@test "--repeat requires --ci and a positive count" {
+    run bash "$SHELL_BUN" --repeat 3 "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "--repeat requires --ci" ]]
+
+    run bash "$SHELL_BUN" --ci Soak steady --repeat 0 "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "--repeat requires a positive number" ]]
+
+    run bash "$SHELL_BUN" --ci Soak steady --repeat-parallel=many "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "--repeat-parallel requires a positive number" ]]
+}
+
+@test "# in the menu repeats the highlighted action with one log per iteration" {
+    if ! script -qec true /dev/null >/dev/null 2>&1; then
+        skip "util-linux 'script' is required to emulate a terminal"
+    fi
+    run bash -c "(sleep 1; printf 'steady'; sleep 0.3; printf '#'; sleep 0.3; printf '2\r'; sleep 1.5; printf '\r'; sleep 0.5; printf 'q'; sleep 0.3; printf '\033'; sleep 0.3) | script -qec \"stty cols 200; bash '$SHELL_BUN' '$TEST_CONFIG'\" /dev/null"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Run 1 action(s) how many times?" ]]
+    [[ "$output" =~ "Soak - steady: 2/2 passed (100%)" ]]
+    [[ "$output" =~ "SUCCESS: Soak - steady #2" ]]
+    ls "$BATS_TEST_TMPDIR/logs/"*_Soak_steady_iter1.log
+    ls "$BATS_TEST_TMPDIR/logs/"*_Soak_steady_iter2.log
+    grep -q "steady run" "$BATS_TEST_TMPDIR/logs/"*_Soak_steady_iter2.log
+}
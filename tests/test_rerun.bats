@@ -0,0 +1,65 @@
+#!/usr/bin/env bats
+
+# Test running failed or all actions of a batch again from the log viewer (r and R)
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_CONFIG="$BATS_TEST_TMPDIR/rerun.cfg"
+    LOG_DIR="$BATS_TEST_TMPDIR/logs"
+    COUNTER="$BATS_TEST_TMPDIR/runs"
+
+    # The interactive UI needs a terminal; util-linux 'script' provides one
+    if ! script -qec true /dev/null >/dev/null 2>&1; then
+        skip "util-linux 'script' is required to emulate a terminal"
+    fi
+
+    # test fails on its first run only
+    cat > "$TEST_CONFIG" << EOF
+log_dir=$LOG_DIR
+
+[Portal]
+build=echo "Building Portal"
+test=echo run >> '$COUNTER'; [ \$(wc -l < '$COUNTER') -gt 1 ] || exit 2
+EOF
+}
+
+# Select every action, run them, then feed the given log viewer keys, waiting
+# for the actions to finish after each one
+run_batch_then_keys() {
+    local script="sleep 1; printf '+'; sleep 0.3; printf '\r'; sleep 3"
+    local key
+    for key in "$@"; do
+        script="$script; printf '$key'; sleep 3"
+    done
+    run bash -c "($script; printf 'q'; sleep 0.3; printf '\033'; sleep 0.3) | script -qec \"stty rows 30 cols 200; bash '$SHELL_BUN' --no-trust-check '$TEST_CONFIG'\" /dev/null"
+}
+
+@test "r runs the failed actions again and their new results replace the old ones" {
+    run_batch_then_keys r
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "r to re-run failed, R to re-run all" ]]
+    [[ "$output" =~ "FAILED: Portal - test" ]]
+    [[ "$output" =~ "Executing 1 selected items in parallel" ]]
+    # The last log viewer shows both actions as successful
+    local last_viewer="${output##*Select a log file to view}"
+    [[ "$last_viewer" =~ "SUCCESS: Portal - test" ]]
+    [[ "$last_viewer" =~ "SUCCESS: Portal - build" ]]
+    [[ ! "$last_viewer" =~ "FAILED:" ]]
+    [ "$(wc -l < "$COUNTER")" -eq 2 ]
+    # The re-run wrote a new log; build was not run again
+    [ "$(find "$LOG_DIR" -name '*_Portal_test.log' | wc -l)" -eq 2 ]
+    [ "$(find "$LOG_DIR" -name '*_Portal_build.log' | wc -l)" -eq 1 ]
+}
+
+@test "r without failures says so and R runs every action again" {
+    echo run > "$COUNTER"
+    run_batch_then_keys r R
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "No failed actions to re-run; R re-runs every action of the batch" ]]
+    [ "$(wc -l < "$COUNTER")" -eq 3 ]
+    [ "$(find "$LOG_DIR" -name '*_Portal_test.log' | wc -l)" -eq 2 ]
+    [ "$(find "$LOG_DIR" -name '*_Portal_build.log' | wc -l)" -eq 2 ]
+}
@@ -0,0 +1,109 @@
+#!/usr/bin/env bats
+
+# Test retrying failed actions (ACTION.retries), limited to failure categories with ACTION.retry_on
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_CONFIG="$BATS_TEST_TMPDIR/retry.cfg"
+    COUNT="$BATS_TEST_TMPDIR/count"
+
+    # flaky fails with a network error twice before it succeeds, broken always fails to compile
+    cat > "$TEST_CONFIG" << EOF
+log_dir=$BATS_TEST_TMPDIR/logs
+classify.network=Connection (refused|reset)
+classify.compile=error:
+
+[App]
+flaky=n=\$(cat "$COUNT.flaky" 2>/dev/null || echo 0); echo \$((n + 1)) > "$COUNT.flaky"; if [ \$n -lt 2 ]; then echo "Connection refused"; exit 1; fi; echo "fetched"
+flaky.retries=3
+flaky.retry_on=network
+broken=n=\$(cat "$COUNT.broken" 2>/dev/null || echo 0); echo \$((n + 1)) > "$COUNT.broken"; echo "error: missing semicolon"; exit 2
+broken.retries=3
+broken.retry_on=network
+EOF
+}
+
+@test "Failures in a retry_on category are retried until the action succeeds" {
+    run bash "$SHELL_BUN" --ci App flaky "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "[shell-bun] Attempt 1 of 4 failed (network); retrying" ]]
+    [[ "$output" =~ "[shell-bun] Attempt 2 of 4 failed (network); retrying" ]]
+    [[ ! "$output" =~ "Attempt 3 of 4" ]]
+    [[ "$output" =~ "Completed: App - flaky ("[0-9]+m?"s, 3 attempts, retried on network)" ]]
+    [ "$(cat "$COUNT.flaky")" -eq 3 ]
+}
+
+@test "Failures in other categories fail at once despite retries" {
+    run bash "$SHELL_BUN" --ci App broken "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [[ ! "$output" =~ "retrying" ]]
+    [[ "$output" =~ "Failed: App - broken ("[0-9]+m?"s)" ]]
+    [ "$(cat "$COUNT.broken")" -eq 1 ]
+}
+
+@test "Without retry_on every failure is retried, up to retries more attempts" {
+    sed -i '/^broken.retry_on=/d; s/^broken.retries=3$/broken.retries=2/' "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --ci App broken "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "[shell-bun] Attempt 2 of 3 failed (compile); retrying" ]]
+    [[ "$output" =~ "Failed: App - broken ("[0-9]+m?"s, 3 attempts, retried on compile)" ]]
+    [ "$(cat "$COUNT.broken")" -eq 3 ]
+}
+
+@test "allow_failure applies to the last attempt" {
+    # flaky only gets one retry, which is not enough
+    sed -i 's/^flaky.retries=3$/flaky.retries=1/' "$TEST_CONFIG"
+    echo "allow_failure=flaky, broken" >> "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --ci App flaky,broken "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Failed: App - flaky ("[0-9]+m?"s, 2 attempts, retried on network)" ]]
+    [[ "$output" =~ "  - App - flaky [network] (allowed to fail)" ]]
+    [[ "$output" =~ "  - App - broken [compile] (allowed to fail)" ]]
+    [ "$(cat "$COUNT.flaky")" -eq 2 ]
+    [ "$(cat "$COUNT.broken")" -eq 1 ]
+
+    # An allowed action that succeeds on a retry counts as successful
+    rm -f "$COUNT.flaky"
+    sed -i 's/^flaky.retries=1$/flaky.retries=2/' "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --ci App flaky,broken "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Successful operations: 1" ]]
+    [[ "$output" =~ "Failed operations: 1" ]]
+}
+
+@test "The JSON report records the attempts and the category retried on" {
+    run bash -c "bash '$SHELL_BUN' --ci App flaky,broken --output json '$TEST_CONFIG' 2>/dev/null"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ '"action":"flaky",'.*'"attempts":3,"retried_on":"network","category":null,"tags":[]}' ]]
+    [[ "$output" =~ '"action":"broken",'.*'"attempts":1,"retried_on":null,"category":"compile","tags":[]}' ]]
+}
+
+@test "Retry settings that have no effect are reported" {
+    cat >> "$TEST_CONFIG" << 'EOF'
+unit=exit 1
+unit.retry_on=network, licence
+lint=exit 1
+lint.retries=twice
+EOF
+    run bash "$SHELL_BUN" --validate "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "[App] unit.retry_on: unit.retries is not set, so nothing is retried ($TEST_CONFIG:13)" ]]
+    [[ "$output" =~ "[App] unit.retry_on: no classify rule named 'licence' ($TEST_CONFIG:13)" ]]
+    [[ "$output" =~ "Ignoring invalid lint.retries 'twice' in [App] (expected a number) ($TEST_CONFIG:15)" ]]
+}
+
+@test "Logs of menu runs keep every attempt and the summary shows how many were used" {
+    if ! script -qec true /dev/null >/dev/null 2>&1; then
+        skip "util-linux 'script' is required to emulate a terminal"
+    fi
+    run bash -c "(sleep 1; printf '+'; sleep 0.3; printf '\r'; sleep 3; printf 'q'; sleep 0.5; printf '\033'; sleep 0.3) | script -qec \"stty cols 200; bash '$SHELL_BUN' --no-trust-check '$TEST_CONFIG'\" /dev/null"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "App flaky "[0-9]+m?"s (3 attempts, retried on network)" ]]
+    [[ "$output" =~ "App broken "[0-9]+m?"s (exit 2)" ]]
+    run cat "$BATS_TEST_TMPDIR"/logs/*_App_flaky.log
+    [[ "$output" =~ "Connection refused"$'\n'"[shell-bun] Attempt 1 of 4 failed (network); retrying"$'\n'"Connection refused" ]]
+    [[ "$output" =~ "[shell-bun] Attempts: 3 of 4, retried on network" ]]
+}
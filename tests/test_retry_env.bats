@@ -0,0 +1,80 @@
+#!/usr/bin/env bats
+
+# Test retrying a failed action from the log viewer with extra environment variables (e)
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_CONFIG="$BATS_TEST_TMPDIR/retry.cfg"
+    LOG_DIR="$BATS_TEST_TMPDIR/logs"
+
+    # The interactive UI needs a terminal; util-linux 'script' provides one
+    if ! script -qec true /dev/null >/dev/null 2>&1; then
+        skip "util-linux 'script' is required to emulate a terminal"
+    fi
+
+    # greet fails unless NAME is set
+    cat > "$TEST_CONFIG" << EOF
+log_dir=$LOG_DIR
+env_GREETING=Hello
+
+[Portal]
+build=echo "Building Portal"
+greet=[ -n "\$NAME" ] || exit 3; echo "\$GREETING \$NAME"
+EOF
+}
+
+# Select every action, run them, then feed the given log viewer keys, waiting
+# for the actions to finish after each one
+run_batch_then_keys() {
+    local script="sleep 1; printf '+'; sleep 0.3; printf '\r'; sleep 3"
+    local key
+    for key in "$@"; do
+        script="$script; printf '$key'; sleep 3"
+    done
+    run bash -c "($script; printf 'q'; sleep 0.3; printf '\033'; sleep 0.3) | script -qec \"stty rows 30 cols 200; bash '$SHELL_BUN' '$TEST_CONFIG'\" /dev/null"
+}
+
+@test "e retries the highlighted failed action with extra environment variables" {
+    run_batch_then_keys e 'NAME=World GREETING=Hi\r'
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "e to retry with env" ]]
+    [[ "$output" =~ "Environment for Portal - greet (KEY=VALUE, separated by spaces):" ]]
+    [[ "$output" =~ "Retrying Portal - greet with NAME=World GREETING=Hi..." ]]
+    # The failed result stays next to the retry, which is marked with its environment
+    local last_viewer="${output##*Select a log file to view}"
+    [[ "$last_viewer" =~ "FAILED: Portal - greet" ]]
+    [[ "$last_viewer" =~ "SUCCESS: Portal - greet".*"(retry with NAME=World GREETING=Hi)" ]]
+    [[ "$last_viewer" =~ "SUCCESS: Portal - build" ]]
+    local retry_log
+    retry_log=$(grep -l "Hi World" "$LOG_DIR"/*_Portal_greet.log)
+    [ "$(head -n 1 "$retry_log")" = "[shell-bun] Retry with environment: NAME=World GREETING=Hi" ]
+    [ "$(find "$LOG_DIR" -name '*_Portal_greet.log' | wc -l)" -eq 2 ]
+    [ "$(find "$LOG_DIR" -name '*_Portal_build.log' | wc -l)" -eq 1 ]
+}
+
+@test "The environment of a retry is not used by the next one" {
+    run_batch_then_keys e 'NAME=World\r' e 'OTHER=1\r'
+    [ "$status" -eq 0 ]
+    [ "$(grep -l "Hello World" "$LOG_DIR"/*_Portal_greet.log | wc -l)" -eq 1 ]
+    [ "$(grep -l "Retry with environment: OTHER=1" "$LOG_DIR"/*_Portal_greet.log | wc -l)" -eq 1 ]
+    [ "$(find "$LOG_DIR" -name '*_Portal_greet.log' | wc -l)" -eq 3 ]
+    local last_viewer="${output##*Select a log file to view}"
+    [[ "$last_viewer" =~ "FAILED: Portal - greet".*"(retry with OTHER=1)" ]]
+}
+
+@test "e on a successful action or with a malformed pair retries nothing" {
+    sed -i 's/^greet=.*/greet=echo "Hello"/' "$TEST_CONFIG"
+    run_batch_then_keys e
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Highlight a failed action to retry it with other environment variables" ]]
+
+    sed -i 's/^greet=.*/greet=exit 3/' "$TEST_CONFIG"
+    rm -rf "$LOG_DIR"
+    run_batch_then_keys e 'NAME\r'
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Not a KEY=VALUE pair: 'NAME'" ]]
+    [ "$(find "$LOG_DIR" -name '*_Portal_greet.log' | wc -l)" -eq 1 ]
+}
@@ -0,0 +1,87 @@
+#!/usr/bin/env bats
+
+# Test the review plan shown before large batches run
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_CONFIG="$BATS_TEST_TMPDIR/review.cfg"
+    LOG_DIR="$BATS_TEST_TMPDIR/logs"
+
+    # The interactive UI needs a terminal; util-linux 'script' provides one
+    if ! script -qec true /dev/null >/dev/null 2>&1; then
+        skip "util-linux 'script' is required to emulate a terminal"
+    fi
+
+    cat > "$TEST_CONFIG" << EOF
+log_dir=$LOG_DIR
+review_threshold=2
+
+[AppA]
+one=echo one
+two=echo two
+
+[AppB]
+working_dir=/nonexistent/review_dir
+three=echo three
+EOF
+}
+
+# Select everything with '+', press Enter, then feed the given review keys
+run_review_with_keys() {
+    local keys="$1"
+    run bash -c "(sleep 1; printf '+'; sleep 0.3; printf '\r'; sleep 0.5; printf '$keys'; sleep 1.5; printf 'q'; sleep 0.5; printf '\033'; sleep 0.3) | script -qec \"stty cols 200; bash '$SHELL_BUN' '$TEST_CONFIG'\" /dev/null"
+}
+
+@test "Review plan lists resolved working dirs and container mode" {
+    run_review_with_keys 'q'
+    [[ "$output" =~ "Review plan: 3 of 3 action(s) will run" ]]
+    [[ "$output" =~ AppA\ -\ one\ +$SCRIPT_DIR\ +no ]]
+    [[ "$output" =~ AppB\ -\ three\ +/nonexistent/review_dir ]]
+}
+
+@test "Review plan flags entries with warnings" {
+    run_review_with_keys 'q'
+    [[ "$output" =~ "⚠ missing working dir" ]]
+}
+
+@test "Review plan flags allow_failure actions and those that ask to confirm" {
+    { echo "min_free_space=1000T"; cat "$TEST_CONFIG"; echo "[AppC]"; echo "four=echo four"; echo "allow_failure=four"; } > "$TEST_CONFIG.new"
+    mv "$TEST_CONFIG.new" "$TEST_CONFIG"
+    run_review_with_keys 'q'
+    [[ "$output" =~ "⚠ confirm required: low free space" ]]
+    [[ "$output" =~ "confirm required: low free space; allow failure" ]]
+}
+
+@test "Cancelling the review plan runs nothing" {
+    run_review_with_keys 'q'
+    [ "$status" -eq 0 ]
+    [[ ! "$output" =~ "Starting:" ]]
+    [[ ! -d "$LOG_DIR" ]]
+}
+
+@test "Deselected rows are not run" {
+    run_review_with_keys $'\033[B \r'
+    [[ "$output" =~ "Review plan: 2 of 3 action(s) will run" ]]
+    [[ "$output" =~ "Starting: AppA - one" ]]
+    [[ ! "$output" =~ "Starting: AppA - two" ]]
+    [[ "$output" =~ "Starting: AppB - three" ]]
+}
+
+@test "Small batches skip the review plan" {
+    { echo "review_threshold=5"; grep -v '^review_threshold=' "$TEST_CONFIG"; } > "$TEST_CONFIG.new"
+    mv "$TEST_CONFIG.new" "$TEST_CONFIG"
+    run_review_with_keys ''
+    [[ ! "$output" =~ "Review plan" ]]
+    [[ "$output" =~ "Starting: AppA - one" ]]
+}
+
+@test "p shows the execution plan of the included rows" {
+    # Any key (x) leaves the plan view again
+    run_review_with_keys $'\033[B px'
+    [[ "$output" =~ "Execution plan: 2 action(s)" ]]
+    [[ "$output" =~ "Wave 1: AppA - one, AppB - three" ]]
+    [[ ! "$output" =~ "Starting:" ]]
+}
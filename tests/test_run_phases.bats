@@ -0,0 +1,69 @@
+#!/usr/bin/env bats
+
+# Test the phase timestamps recorded for each action run
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_CONFIG="$BATS_TEST_TMPDIR/phases.cfg"
+    LOG_DIR="$BATS_TEST_TMPDIR/logs"
+
+    # The interactive UI needs a terminal; util-linux 'script' provides one
+    if ! script -qec true /dev/null >/dev/null 2>&1; then
+        skip "util-linux 'script' is required to emulate a terminal"
+    fi
+
+    cat > "$TEST_CONFIG" << EOF
+log_dir=$LOG_DIR
+
+[Portal]
+build=sleep 0.5; echo "Building Portal"; sleep 0.3
+quiet=sleep 0.2
+EOF
+}
+
+# Select every action, run them, then feed the given log viewer keys
+run_batch_then_keys() {
+    local keys="$1"
+    run bash -c "(sleep 1; printf '+'; sleep 0.3; printf '\r'; sleep 2.5; printf '$keys'; sleep 0.5; printf 'q'; sleep 0.3; printf '\033'; sleep 0.3) | script -qec \"stty cols 200; bash '$SHELL_BUN' '$TEST_CONFIG'\" /dev/null"
+}
+
+@test "The log records the phases of the run before its footer" {
+    run_batch_then_keys ''
+    [ "$status" -eq 0 ]
+    local log_file
+    log_file=$(ls "$LOG_DIR"/*_Portal_build.log)
+    run tail -n 2 "$log_file"
+    [[ "${lines[0]}" =~ ^\[shell-bun\]\ Phases:\ built=[0-9.]+\ started=[0-9.]+\ first_output=[0-9.]+\ exited=[0-9.]+\ closed=[0-9.]+$ ]]
+    [[ "${lines[1]}" =~ ^\[shell-bun\]\ Finished\ with\ exit\ code\ 0 ]]
+    # The phases are kept aside only while the action runs
+    [ "$(ls "$LOG_DIR" | grep -c '\.phases$')" -eq 0 ]
+}
+
+@test "The log viewer shows the phase breakdown of the highlighted result" {
+    run_batch_then_keys ''
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ Phases:\ preparing\ [0-9]+\.[0-9]{2}s,\ until\ first\ output\ 0\.[5-9][0-9]s,\ output\ until\ exit\ 0\.[0-9]{2}s,\ closing\ log\ [0-9]+\.[0-9]{2}s ]]
+}
+
+@test "Phases that were not recorded are left out of the breakdown" {
+    run_batch_then_keys $'\033[B'
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ Phases:\ preparing\ [0-9]+\.[0-9]{2}s,\ running\ without\ output\ 0\.[0-9]{2}s,\ closing\ log ]]
+    ! grep -q 'first_output=' "$LOG_DIR"/*_Portal_quiet.log
+}
+
+@test "A signalled action keeps the phases recorded until the signal" {
+    cat > "$TEST_CONFIG" << EOF
+log_dir=$LOG_DIR
+
+[SlowApp]
+hang=echo "warming up"; sleep 30
+EOF
+    run bash -c "(sleep 1; printf ' '; sleep 0.3; printf '\r'; sleep 1.5; printf 't'; sleep 1.5; printf 'q'; sleep 0.5; printf '\033'; sleep 0.3) | script -qec \"bash '$SHELL_BUN' '$TEST_CONFIG'\" /dev/null"
+    [ "$status" -eq 0 ]
+    grep -q '^\[shell-bun\] Phases: built=[0-9.]* started=[0-9.]* first_output=[0-9.]* closed=[0-9.]*$' "$LOG_DIR"/*_SlowApp_hang.log
+    [ "$(tail -n 1 "$LOG_DIR"/*_SlowApp_hang.log)" = "[shell-bun] Action ended by SIGTERM sent from the running view" ]
+}
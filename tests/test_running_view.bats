@@ -0,0 +1,160 @@
+#!/usr/bin/env bats
+
+# Test the running view shown while a batch of actions executes
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_CONFIG="$BATS_TEST_TMPDIR/running.cfg"
+    LOG_DIR="$BATS_TEST_TMPDIR/logs"
+
+    # The interactive UI needs a terminal; util-linux 'script' provides one
+    if ! script -qec true /dev/null >/dev/null 2>&1; then
+        skip "util-linux 'script' is required to emulate a terminal"
+    fi
+
+    cat > "$TEST_CONFIG" << EOF
+log_dir=$LOG_DIR
+
+[SlowApp]
+hang=sleep 30
+EOF
+}
+
+# Select the first item, run it, then feed the given running-view keys
+run_batch_with_keys() {
+    local keys="$1"
+    run bash -c "(sleep 1; printf ' '; sleep 0.3; printf '\r'; sleep 1.5; printf '$keys'; sleep 1.5; printf 'q'; sleep 0.5; printf '\033'; sleep 0.3) | script -qec \"bash '$SHELL_BUN' '$TEST_CONFIG'\" /dev/null"
+}
+
+@test "Running view shows PID and process group of running actions" {
+    run_batch_with_keys 't'
+    [[ "$output" =~ SlowApp\ -\ hang\ \ PID\ [0-9]+\ \ PGID\ [0-9]+ ]]
+}
+
+@test "SIGTERM ends the highlighted action and is recorded in the result" {
+    run_batch_with_keys 't'
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Sent SIGTERM to SlowApp - hang" ]]
+    [[ "$output" =~ "FAILED: SlowApp - hang [SIGTERM]" ]]
+    grep -q "ended by SIGTERM" "$LOG_DIR"/*_SlowApp_hang.log
+}
+
+@test "SIGKILL asks for confirmation before it is sent" {
+    run_batch_with_keys 'knt'
+    [[ "$output" =~ "Send SIGKILL to SlowApp - hang" ]]
+    [[ "$output" =~ "SIGKILL cancelled" ]]
+}
+
+@test "Confirmed SIGKILL ends the action and is recorded in the result" {
+    run_batch_with_keys 'ky'
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "FAILED: SlowApp - hang [SIGKILL]" ]]
+}
+
+@test "Output of the highlighted action is shown while it runs" {
+    cat > "$TEST_CONFIG" << EOF
+log_dir=$LOG_DIR
+
+[SlowApp]
+hang=echo "warming up"; printf 'step 1\rstep 2\n'; printf '\033[31mcolored\033[0m\n'; sleep 30
+EOF
+    run_batch_with_keys 't'
+    [[ "$output" =~ "Output of SlowApp - hang:" ]]
+    [[ "$output" =~ "  warming up" ]]
+    [[ "$output" =~ "  step 2" ]]
+    [[ "$output" =~ "  colored" ]]
+    # The log file is written as before
+    grep -q $'step 1\rstep 2' "$LOG_DIR"/*_SlowApp_hang.log
+}
+
+@test "Tab and arrows switch the output between concurrent actions" {
+    cat > "$TEST_CONFIG" << EOF
+log_dir=$LOG_DIR
+
+[SlowApp]
+first=echo "output of first"; sleep 30
+second=echo "output of second"; sleep 30
+EOF
+    run bash -c "(sleep 1; printf '+'; sleep 0.3; printf '\r'; sleep 1.5; printf '\t'; sleep 1.5; printf '\033[D'; sleep 1.5; printf '\033[C'; sleep 1.5; printf 't'; sleep 0.3; printf '\033[D'; sleep 0.3; printf 't'; sleep 1.5; printf 'q'; sleep 0.5; printf '\033'; sleep 0.3) | script -qec \"bash '$SHELL_BUN' '$TEST_CONFIG'\" /dev/null"
+    [ "$status" -eq 0 ]
+    [ "$(echo "$output" | grep -c "Output of SlowApp - second:")" -ge 2 ]
+    [[ "$output" =~ "  output of second" ]]
+    [[ "$output" =~ "  output of first" ]]
+}
+
+@test "a shows the output of all actions, each line labelled with its action" {
+    cat > "$TEST_CONFIG" << EOF
+log_dir=$LOG_DIR
+
+[SlowApp]
+first=echo "output of first"; sleep 30
+second=sleep 0.5; echo "output of second"; sleep 30
+EOF
+    run bash -c "(sleep 1; printf '+'; sleep 0.3; printf '\r'; sleep 1.5; printf 'a'; sleep 1.5; printf 't'; sleep 0.3; printf '\t'; sleep 0.3; printf 't'; sleep 1.5; printf 'q'; sleep 0.5; printf '\033'; sleep 0.3) | script -qec \"bash '$SHELL_BUN' '$TEST_CONFIG'\" /dev/null"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Output of all actions:" ]]
+    [[ "$output" =~ "  [SlowApp - first] output of first"[^$'\n']*$'\r'*$'\n'"  [SlowApp - second] output of second" ]]
+    # The logs are written as before, without labels
+    [ "$(cat "$LOG_DIR"/*_SlowApp_second.log | head -n 1)" = "output of second" ]
+}
+
+@test "PgUp scrolls the output back" {
+    cat > "$TEST_CONFIG" << EOF
+log_dir=$LOG_DIR
+
+[SlowApp]
+hang=seq 1 200 | sed 's/^/line /'; sleep 30
+EOF
+    run_batch_with_keys '\033[5~t'
+    [[ "$output" =~ "line 200" ]]
+    [[ "$output" =~ Output\ of\ SlowApp\ -\ hang\ \([0-9]+\ lines\ up,\ PgDn\ to\ follow\) ]]
+}
+
+@test "x cancels the highlighted action and reports it as cancelled" {
+    run_batch_with_keys 'x'
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Cancelled SlowApp - hang" ]]
+    [[ "$output" =~ "CANCELLED: SlowApp - hang (" ]]
+    [[ ! "$output" =~ "FAILED: SlowApp - hang" ]]
+    grep -q '^\[shell-bun\] Action cancelled from the running view (SIGTERM sent to its process group) after [0-9]*s$' "$LOG_DIR"/*_SlowApp_hang.log
+}
+
+@test "A waiting action cancelled with x never starts" {
+    cat > "$TEST_CONFIG" << EOF
+log_dir=$LOG_DIR
+
+[SlowApp]
+first=sleep 30
+second=echo "second ran"
+second.after=first
+EOF
+    # Cancel second while it waits for first, then cancel first
+    run bash -c "(sleep 1; printf '+'; sleep 0.3; printf '\r'; sleep 1.5; printf '\033[B'; sleep 0.3; printf 'x'; sleep 0.5; printf '\033[A'; sleep 0.3; printf 'x'; sleep 1.5; printf 'q'; sleep 0.5; printf '\033'; sleep 0.3) | script -qec \"stty cols 200; bash '$SHELL_BUN' '$TEST_CONFIG'\" /dev/null"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "SlowApp - second  [cancelled]" ]]
+    [[ "$output" =~ "Output of SlowApp - second: cancelled before it started" ]]
+    [[ "$output" =~ "⊘ SlowApp second (cancelled)" ]]
+    [[ "$output" =~ "⊘ Cancelled: 2" ]]
+    ! grep -q "second ran" "$LOG_DIR"/*_SlowApp_second.log
+    grep -q "cancelled from the running view before it started" "$LOG_DIR"/*_SlowApp_second.log
+}
+
+@test "X asks before cancelling every remaining action" {
+    cat > "$TEST_CONFIG" << EOF
+log_dir=$LOG_DIR
+
+[SlowApp]
+first=sleep 30
+second=sleep 30
+EOF
+    run bash -c "(sleep 1; printf '+'; sleep 0.3; printf '\r'; sleep 1.5; printf 'Xn'; sleep 0.5; printf 'Xy'; sleep 1.5; printf 'q'; sleep 0.5; printf '\033'; sleep 0.3) | script -qec \"stty cols 200; bash '$SHELL_BUN' '$TEST_CONFIG'\" /dev/null"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Cancel all 2 running and waiting action(s)? [y/N]" ]]
+    [[ "$output" =~ "Nothing cancelled" ]]
+    [[ "$output" =~ "Cancelled 2 action(s)" ]]
+    [[ "$output" =~ "CANCELLED: SlowApp - first (" ]]
+    [[ "$output" =~ "CANCELLED: SlowApp - second (" ]]
+}
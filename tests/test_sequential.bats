@@ -0,0 +1,110 @@
+#!/usr/bin/env bats
+
+# Test sequential runs (--sequential, parallel=false) that stop at the first failure
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_CONFIG="$BATS_TEST_TMPDIR/pipeline.cfg"
+    ORDER_FILE="$BATS_TEST_TMPDIR/order.txt"
+
+    cat > "$TEST_CONFIG" << EOF
+log_dir=$BATS_TEST_TMPDIR/logs
+
+[Pipeline]
+allow_failure=lint
+clean=sleep 0.5; echo clean >> "$ORDER_FILE"
+build=sleep 0.2; echo build >> "$ORDER_FILE"
+test=echo test >> "$ORDER_FILE"
+broken=echo broken >> "$ORDER_FILE"; exit 2
+lint=echo lint >> "$ORDER_FILE"; exit 1
+EOF
+}
+
+@test "--sequential runs the actions one at a time in the order they were matched" {
+    run bash "$SHELL_BUN" --ci Pipeline clean,build,test --sequential "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [ "$(tr '\n' ' ' < "$ORDER_FILE")" = "clean build test " ]
+    [[ "$output" =~ "Fuzzy Pattern Execution (Sequential)" ]]
+    [[ "$output" =~ "CI Execution Summary (Sequential):" ]]
+    [[ "$output" =~ "All operations completed successfully" ]]
+}
+
+@test "--sequential stops at the first failure and lists the actions not run" {
+    run bash "$SHELL_BUN" --ci Pipeline clean,broken,build,test --sequential "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [ "$(tr '\n' ' ' < "$ORDER_FILE")" = "clean broken " ]
+    [[ "$output" =~ "Stopping after Pipeline - broken failed: 2 action(s) not run" ]]
+    [[ "$output" =~ "Commands executed: 2" ]]
+    [[ "$output" =~ "Aborted at: Pipeline - broken" ]]
+    [[ "$output" =~ "Not run:"$'\n'"  - Pipeline - build"$'\n'"  - Pipeline - test" ]]
+}
+
+@test "--sequential does not stop for actions allowed to fail" {
+    run bash "$SHELL_BUN" --ci Pipeline lint,test --sequential "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [ "$(tr '\n' ' ' < "$ORDER_FILE")" = "lint test " ]
+    [[ ! "$output" =~ "Aborted at" ]]
+}
+
+@test "--sequential respects after constraints" {
+    echo "clean.after=test" >> "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --ci Pipeline clean,test --sequential "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [ "$(tr '\n' ' ' < "$ORDER_FILE")" = "test clean " ]
+}
+
+@test "--sequential requires CI mode and cannot be combined with quality gates" {
+    run bash "$SHELL_BUN" --sequential "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "--sequential requires --ci" ]]
+
+    run bash "$SHELL_BUN" --ci Pipeline all --sequential --max-failures 1 "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "cannot be combined with --repeat, --max-failures or --min-pass-rate" ]]
+    [ ! -e "$ORDER_FILE" ]
+}
+
+@test "parallel=false runs CI batches one at a time; stop_on_error=false goes on after failures" {
+    printf 'parallel=false\n' | cat - "$TEST_CONFIG" > "$TEST_CONFIG.new"
+    mv "$TEST_CONFIG.new" "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --ci Pipeline clean,broken,build --no-trust-check "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [ "$(tr '\n' ' ' < "$ORDER_FILE")" = "clean broken " ]
+    [[ "$output" =~ "Fuzzy Pattern Execution (Sequential)" ]]
+
+    rm -f "$ORDER_FILE"
+    printf 'stop_on_error=false\n' | cat - "$TEST_CONFIG" > "$TEST_CONFIG.new"
+    mv "$TEST_CONFIG.new" "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --ci Pipeline clean,broken,build --no-trust-check "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [ "$(tr '\n' ' ' < "$ORDER_FILE")" = "clean broken build " ]
+    [[ "$output" =~ "one at a time, going on after failures" ]]
+    [[ ! "$output" =~ "Not run:" ]]
+
+    # --jobs runs the batch in parallel again
+    run bash "$SHELL_BUN" --ci Pipeline clean,build --jobs 2 --no-trust-check "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Fuzzy Pattern Execution (Parallel)" ]]
+
+    printf 'parallel=sometimes\n' | cat - "$TEST_CONFIG" > "$TEST_CONFIG.new"
+    mv "$TEST_CONFIG.new" "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --ci Pipeline test --no-trust-check "$TEST_CONFIG"
+    [[ "$output" =~ "Ignoring invalid parallel 'sometimes' (expected true or false)" ]]
+}
+
+@test "'&' switches menu batches to one at a time, stopping at the first failure" {
+    if ! script -qec true /dev/null >/dev/null 2>&1; then
+        skip "util-linux 'script' is required to emulate a terminal"
+    fi
+    # Select broken, then clean (selection order), switch to sequential and run
+    run bash -c "(sleep 1; printf 'broken'; sleep 0.3; printf ' '; sleep 0.3; printf '\177\177\177\177\177\177clean'; sleep 0.3; printf ' '; sleep 0.3; printf '&'; sleep 0.5; printf '\r'; sleep 3; printf 'q'; sleep 0.3; printf '\033'; sleep 0.3) | script -qec \"stty cols 200 rows 30; bash '$SHELL_BUN' --no-trust-check '$TEST_CONFIG'\" /dev/null"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Batches: parallel ('&' switches)" ]]
+    [[ "$output" =~ "Batches: sequential ('&' switches)" ]]
+    [[ "$output" =~ "Executing 2 selected items one at a time" ]]
+    [ "$(tr '\n' ' ' < "$ORDER_FILE")" = "broken " ]
+    [[ "$output" =~ "Pipeline clean (skipped, stopped after Pipeline - broken failed)" ]]
+}
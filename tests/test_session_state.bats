@@ -0,0 +1,90 @@
+#!/usr/bin/env bats
+
+# Test that the menu's filter, selections and highlighted item are saved on quit
+# and on run start, and restored the next time the same config is opened
+
+load helpers/terminal
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    export LOG_DIR="$BATS_TEST_TMPDIR/logs"
+    STATE_DIR="$BATS_TEST_TMPDIR/state"
+    TEST_CONFIG="$BATS_TEST_TMPDIR/session.cfg"
+    cat > "$TEST_CONFIG" << EOF2
+log_dir=$LOG_DIR
+
+[Frontend]
+build=echo frontend build
+lint=echo frontend lint
+
+[Backend]
+build=echo backend build
+test=echo backend test
+EOF2
+}
+
+# Function to print the saved session of the test config
+session_file() {
+    cat "$STATE_DIR"/*/session
+}
+
+@test "Session state: filter, selections and cursor are restored on the next start" {
+    require_terminal
+    run_terminal --state-dir "$STATE_DIR" "$TEST_CONFIG" -- b u i l d space down space esc
+    [ "$status" -eq 0 ]
+    run session_file
+    [[ "$output" =~ "filter=build" ]]
+    [[ "$output" =~ "selected=Frontend - build" ]]
+    [[ "$output" =~ "selected=Backend - build" ]]
+
+    run_terminal --state-dir "$STATE_DIR" "$TEST_CONFIG" -- esc
+    local frame
+    frame=$(plain_output)
+    [[ "$frame" =~ "Filter: build" ]]
+    [[ "$frame" =~ "Selected: 2" ]]
+}
+
+@test "Session state: selections are saved by name when a run starts and dropped once the action is gone" {
+    require_terminal
+    run_terminal --state-dir "$STATE_DIR" "$TEST_CONFIG" -- t e s t space enter wait:2 q esc
+    run session_file
+    [[ "$output" =~ "cursor=Backend - test" ]]
+    [[ "$output" =~ "selected=Backend - test" ]]
+
+    # The config changed: Backend - test is gone, Frontend - lint moved
+    cat > "$TEST_CONFIG" << EOF2
+log_dir=$LOG_DIR
+
+[Frontend]
+lint=echo frontend lint
+build=echo frontend build
+EOF2
+    printf 'filter=\ncursor=Frontend - lint\nselected=Backend - test\nselected=Frontend - lint\n' > "$(ls -d "$STATE_DIR"/*)/session"
+    rm -rf "$LOG_DIR"
+    run_terminal --state-dir "$STATE_DIR" "$TEST_CONFIG" -- enter wait:2 q esc
+    assert_log_matches Frontend lint '^frontend lint$'
+    [ -z "$(ls "$LOG_DIR" | grep -v Frontend_lint)" ]
+}
+
+@test "Session state: --fresh and Ctrl+R forget the saved session" {
+    require_terminal
+    run_terminal --state-dir "$STATE_DIR" "$TEST_CONFIG" -- l i n t space esc
+    run session_file
+    [[ "$output" =~ "selected=Frontend - lint" ]]
+
+    run_terminal --state-dir "$STATE_DIR" "$TEST_CONFIG" -- ctrl-r esc
+    [[ "$(plain_output)" =~ "Saved filter and selections cleared" ]]
+    run session_file
+    [[ "$output" =~ "filter=" ]]
+    [[ ! "$output" =~ "selected=" ]]
+
+    run_terminal --state-dir "$STATE_DIR" "$TEST_CONFIG" -- b a c k esc
+    run_terminal --state-dir "$STATE_DIR" --fresh "$TEST_CONFIG" -- esc
+    [ "$status" -eq 0 ]
+    [[ ! "$(plain_output)" =~ "Filter: back" ]]
+    run session_file
+    [[ ! "$output" =~ "back" ]]
+}
@@ -0,0 +1,105 @@
+#!/usr/bin/env bats
+
+# Test the shell and shell_flag settings: the interpreter commands run with
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_CONFIG="$BATS_TEST_TMPDIR/shell.cfg"
+    export FAKE_SHELL_LOG="$BATS_TEST_TMPDIR/shell.log"
+
+    # A fake shell that records its arguments and runs the command with sh
+    mkdir -p "$BATS_TEST_TMPDIR/bin"
+    cat > "$BATS_TEST_TMPDIR/bin/fakesh" << 'EOF'
+#!/bin/bash
+echo "$*" >> "$FAKE_SHELL_LOG"
+exec sh -c "${@: -1}"
+EOF
+    chmod +x "$BATS_TEST_TMPDIR/bin/fakesh"
+    export PATH="$BATS_TEST_TMPDIR/bin:$PATH"
+}
+
+@test "Commands run with bash -c without a shell setting" {
+    cat > "$TEST_CONFIG" << 'EOF'
+[App]
+build=echo "built"
+EOF
+    run bash "$SHELL_BUN" --ci App build --dry-run "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "bash -c echo" ]]
+}
+
+@test "Global shell with arguments runs every command" {
+    cat > "$TEST_CONFIG" << 'EOF'
+shell=fakesh -e
+
+[App]
+build=echo "built"
+EOF
+    run bash "$SHELL_BUN" --ci App build "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "built" ]]
+    grep -qx -- '-e -c echo "built"' "$FAKE_SHELL_LOG"
+}
+
+@test "App shell and shell_flag override the global ones" {
+    cat > "$TEST_CONFIG" << 'EOF'
+shell=bash
+
+[App]
+shell=fakesh
+shell_flag=-xc
+build=echo "built"
+
+[Other]
+test=echo "tested"
+EOF
+    run bash "$SHELL_BUN" --ci '*' build,test "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "built" ]]
+    [[ "$output" =~ "tested" ]]
+    [ "$(cat "$FAKE_SHELL_LOG")" = '-xc echo "built"' ]
+
+    run bash "$SHELL_BUN" --ci App build --dry-run "$TEST_CONFIG"
+    [[ "$output" =~ "fakesh -xc echo" ]]
+}
+
+@test "Container commands run with the configured shell" {
+    cat > "$TEST_CONFIG" << 'EOF'
+container=docker run --rm ubuntu
+shell=zsh
+
+[App]
+build=echo "built"
+
+[Plain]
+shell_flag=-c
+test=echo "tested"
+EOF
+    run bash "$SHELL_BUN" --ci App build --dry-run "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "docker run --rm ubuntu zsh -c " ]]
+
+    # The login shell stays the default inside containers
+    sed -i '/^shell=zsh$/d' "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --ci Plain test --dry-run "$TEST_CONFIG"
+    [[ "$output" =~ "docker run --rm ubuntu bash -c " ]]
+    sed -i '/^shell_flag=-c$/d' "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --ci Plain test --dry-run "$TEST_CONFIG"
+    [[ "$output" =~ "docker run --rm ubuntu bash -lc " ]]
+}
+
+@test "An empty shell is ignored with a warning" {
+    cat > "$TEST_CONFIG" << 'EOF'
+shell=
+
+[App]
+build=echo "built"
+EOF
+    run bash "$SHELL_BUN" --ci App build "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Ignoring empty shell" ]]
+    [[ "$output" =~ "built" ]]
+}
@@ -0,0 +1,98 @@
+#!/usr/bin/env bats
+
+# Test where local data (trust store, debug.log) is stored
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_FIXTURES="$SCRIPT_DIR/tests/fixtures"
+    export HOME="$BATS_TEST_TMPDIR/home"
+    mkdir -p "$HOME"
+    unset XDG_STATE_HOME XDG_CONFIG_HOME LOCALAPPDATA SHELL_BUN_TRUST_STORE
+    WORK_DIR="$BATS_TEST_TMPDIR/work"
+    mkdir -p "$WORK_DIR"
+    cp "$TEST_FIXTURES/basic.cfg" "$WORK_DIR/shell-bun.cfg"
+    cd "$WORK_DIR"
+}
+
+@test "State dir: Linux defaults to ~/.local/state/shell-bun" {
+    SHELL_BUN_PLATFORM=Linux run bash "$SHELL_BUN" --doctor
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "State dir:    $HOME/.local/state/shell-bun/" ]]
+}
+
+@test "State dir: Linux honors XDG_STATE_HOME" {
+    XDG_STATE_HOME="$BATS_TEST_TMPDIR/xdg" SHELL_BUN_PLATFORM=Linux run bash "$SHELL_BUN" --doctor
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "State dir:    $BATS_TEST_TMPDIR/xdg/shell-bun/" ]]
+}
+
+@test "State dir: macOS uses Application Support" {
+    SHELL_BUN_PLATFORM=Darwin run bash "$SHELL_BUN" --doctor
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "State dir:    $HOME/Library/Application Support/shell-bun/" ]]
+}
+
+@test "State dir: Windows uses LOCALAPPDATA" {
+    LOCALAPPDATA="$BATS_TEST_TMPDIR/appdata" SHELL_BUN_PLATFORM=MINGW64_NT-10.0 run bash "$SHELL_BUN" --doctor
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "State dir:    $BATS_TEST_TMPDIR/appdata/shell-bun/" ]]
+}
+
+@test "State dir: --state-dir overrides the platform default" {
+    run bash "$SHELL_BUN" --state-dir "$BATS_TEST_TMPDIR/custom" --doctor
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "State dir:    $BATS_TEST_TMPDIR/custom/" ]]
+}
+
+@test "State dir: configs get separate directories, however they are named" {
+    local relative absolute other
+    relative=$(bash "$SHELL_BUN" --doctor shell-bun.cfg | grep '^State dir:')
+    absolute=$(bash "$SHELL_BUN" --doctor "$WORK_DIR/shell-bun.cfg" | grep '^State dir:')
+    other=$(bash "$SHELL_BUN" --doctor "$TEST_FIXTURES/basic.cfg" | grep '^State dir:')
+    [ "$relative" = "$absolute" ]
+    [ "$relative" != "$other" ]
+}
+
+@test "State dir: --debug writes debug.log to the state dir, not the working directory" {
+    run bash "$SHELL_BUN" --state-dir "$BATS_TEST_TMPDIR/state" --debug --ci TestApp1 build shell-bun.cfg
+    [ "$status" -eq 0 ]
+    [ ! -f "$WORK_DIR/debug.log" ]
+    grep -q "Terminal profile" "$BATS_TEST_TMPDIR"/state/*/debug.log
+}
+
+@test "State dir: works from a read-only checkout" {
+    unset SHELL_BUN_NO_TRUST_CHECK
+    chmod a-w "$WORK_DIR"
+    run bash "$SHELL_BUN" --state-dir "$BATS_TEST_TMPDIR/state" --debug --trust --ci TestApp1 build
+    chmod u+w "$WORK_DIR"
+    [ "$status" -eq 0 ]
+    [ -f "$BATS_TEST_TMPDIR/state/trusted_configs" ]
+}
+
+@test "State dir: trust store from older versions is migrated" {
+    mkdir -p "$HOME/.config/shell-bun"
+    echo "0000 /old/config.cfg" > "$HOME/.config/shell-bun/trusted_configs"
+    run bash "$SHELL_BUN" --ci TestApp1 build shell-bun.cfg
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Moved $HOME/.config/shell-bun/trusted_configs" ]]
+    [ ! -f "$HOME/.config/shell-bun/trusted_configs" ]
+    grep -q "/old/config.cfg" "$HOME/.local/state/shell-bun/trusted_configs"
+}
+
+@test "State dir: debug.log from older versions is migrated" {
+    echo "[DEBUG] old session" > debug.log
+    run bash "$SHELL_BUN" --ci TestApp1 build shell-bun.cfg
+    [ "$status" -eq 0 ]
+    [ ! -f "$WORK_DIR/debug.log" ]
+    grep -q "old session" "$HOME"/.local/state/shell-bun/*/debug.log
+}
+
+@test "State dir: unrelated debug.log files are left alone" {
+    echo "my own notes" > debug.log
+    run bash "$SHELL_BUN" --ci TestApp1 build shell-bun.cfg
+    [ "$status" -eq 0 ]
+    [ -f "$WORK_DIR/debug.log" ]
+}
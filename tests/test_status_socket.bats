@@ -0,0 +1,151 @@
+#!/usr/bin/env bats
+
+# Test serving the run status as JSON on a unix socket (--status-socket)
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_CONFIG="$BATS_TEST_TMPDIR/status.cfg"
+    SOCKET="$BATS_TEST_TMPDIR/status.sock"
+    export SOCAT_ARGS="$BATS_TEST_TMPDIR/socat.args"
+
+    echo "log_dir=$BATS_TEST_TMPDIR/logs" > "$TEST_CONFIG"
+    cat >> "$TEST_CONFIG" << 'EOF'
+[App]
+first=echo one
+fail=exit 3
+snapshot=cat "$(dirname "$(sed -n 's/^EXEC://p' "$SOCAT_ARGS")")/status.json"
+snapshot.after=first, fail
+EOF
+
+    # Stand-in for socat: records how it was started and keeps running until stopped.
+    # Connections succeed while $SOCAT_ARGS.live exists, as if an instance listened.
+    FAKE_BIN="$BATS_TEST_TMPDIR/bin"
+    mkdir -p "$FAKE_BIN"
+    cat > "$FAKE_BIN/socat" << 'EOF'
+#!/bin/bash
+if [[ "$*" == *UNIX-CONNECT:* ]]; then
+    [[ -f "$SOCAT_ARGS.live" ]]
+    exit
+fi
+printf '%s\n' "$@" > "$SOCAT_ARGS"
+echo $$ > "$SOCAT_ARGS.pid"
+exec sleep 1000
+EOF
+    chmod +x "$FAKE_BIN/socat"
+}
+
+@test "The socket is created owner-only and serves a read-only snapshot" {
+    PATH="$FAKE_BIN:$PATH" run bash "$SHELL_BUN" --status-socket "$SOCKET" --ci App first "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    grep -qx "UNIX-LISTEN:$SOCKET,fork,mode=600" "$SOCAT_ARGS"
+    grep -q '^EXEC:.*/respond$' "$SOCAT_ARGS"
+}
+
+@test "The snapshot lists the actions of the batch with their state and exit code" {
+    PATH="$FAKE_BIN:$PATH" run bash "$SHELL_BUN" --status-socket "$SOCKET" --ci App "first,fail,snapshot" "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ \"mode\":\"ci\" ]]
+    [[ "$output" =~ \"run_id\":\"[0-9]{8}_[0-9]{6}-[0-9]+\" ]]
+    [[ "$output" =~ \"action\":\"first\",\"state\":\"passed\",\"started_at\":[0-9]+,\"exit_code\":0 ]]
+    [[ "$output" =~ \"action\":\"fail\",\"state\":\"failed\",\"started_at\":[0-9]+,\"exit_code\":3 ]]
+    [[ "$output" =~ \"action\":\"snapshot\",\"state\":\"running\",\"started_at\":[0-9]+,\"exit_code\":null ]]
+}
+
+@test "The snapshot carries the tags of the run" {
+    PATH="$FAKE_BIN:$PATH" run bash "$SHELL_BUN" --state-dir "$BATS_TEST_TMPDIR/state" --status-socket "$SOCKET" --tag nightly --ci App snapshot "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ \"run_id\":\"[0-9_-]+\",\"tags\":\[\"nightly\"\],\"actions\" ]]
+}
+
+@test "Recent results carry the run id, exit code and duration" {
+    PATH="$FAKE_BIN:$PATH" run bash "$SHELL_BUN" --status-socket "$SOCKET" --ci App "first,fail,snapshot" "$TEST_CONFIG"
+    [[ "$output" =~ \"recent_results\":\[\{\"run_id\":\"[0-9_-]+\",\"app\":\"App\",\"action\":\"(first|fail)\" ]]
+    [[ "$output" =~ \"action\":\"fail\",\"exit_code\":3,\"finished_at\":[0-9]+,\"duration_seconds\":[0-9]+\} ]]
+}
+
+@test "The server and its snapshot are removed on exit" {
+    PATH="$FAKE_BIN:$PATH" run bash "$SHELL_BUN" --status-socket "$SOCKET" --ci App first "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    local status_dir
+    status_dir=$(dirname "$(sed -n 's/^EXEC://p' "$SOCAT_ARGS")")
+    [ ! -e "$status_dir" ]
+    run kill -0 "$(cat "$SOCAT_ARGS.pid")"
+    [ "$status" -ne 0 ]
+}
+
+@test "A path that exists and is not a socket is refused" {
+    touch "$SOCKET"
+    PATH="$FAKE_BIN:$PATH" run bash "$SHELL_BUN" --status-socket "$SOCKET" --ci App first "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "exists and is not a socket" ]]
+    [ ! -s "$SOCAT_ARGS" ]
+}
+
+@test "A socket another instance listens on is refused, a stale one replaced" {
+    if ! command -v python3 >/dev/null 2>&1; then
+        skip "python3 is required to create a socket"
+    fi
+    python3 -c 'import socket, sys; socket.socket(socket.AF_UNIX).bind(sys.argv[1])' "$SOCKET"
+    [ -S "$SOCKET" ]
+    touch "$SOCAT_ARGS.live"
+    PATH="$FAKE_BIN:$PATH" run bash "$SHELL_BUN" --status-socket "$SOCKET" --ci App first "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "Error: --status-socket path '$SOCKET' is in use by another running instance" ]]
+    [ -S "$SOCKET" ]
+    [ ! -e "$SOCAT_ARGS" ]
+
+    rm "$SOCAT_ARGS.live"
+    PATH="$FAKE_BIN:$PATH" run bash "$SHELL_BUN" --status-socket "$SOCKET" --ci App first "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    grep -qx "UNIX-LISTEN:$SOCKET,fork,mode=600" "$SOCAT_ARGS"
+    [ ! -e "$SOCKET" ]
+}
+
+@test "A missing socat is reported" {
+    if command -v socat >/dev/null 2>&1; then
+        skip "socat is installed"
+    fi
+    run bash "$SHELL_BUN" --status-socket "$SOCKET" --ci App first "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "--status-socket needs socat" ]]
+}
+
+@test "The socket answers HTTP requests with the snapshot" {
+    if ! command -v socat >/dev/null 2>&1 || ! command -v curl >/dev/null 2>&1; then
+        skip "socat and curl are required"
+    fi
+    cat >> "$TEST_CONFIG" << EOF
+query=sleep 0.5; curl -s --unix-socket "$SOCKET" http://localhost/status
+EOF
+    run bash "$SHELL_BUN" --status-socket "$SOCKET" --ci App query "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ \"action\":\"query\",\"state\":\"running\" ]]
+    [ ! -e "$SOCKET" ]
+}
+
+@test "Batches started from the menu are tracked too" {
+    if ! script -qec true /dev/null >/dev/null 2>&1; then
+        skip "util-linux 'script' is required to emulate a terminal"
+    fi
+    run bash -c "(sleep 1; printf '+'; sleep 0.3; printf '\r'; sleep 3; printf 'q'; sleep 0.5; printf '\033'; sleep 0.3) | PATH='$FAKE_BIN':\"\$PATH\" script -qec \"stty cols 200; bash '$SHELL_BUN' --status-socket '$SOCKET' '$TEST_CONFIG'\" /dev/null"
+    [ "$status" -eq 0 ]
+    run cat "$BATS_TEST_TMPDIR"/logs/*_App_snapshot.log
+    [[ "$output" =~ \"mode\":\"interactive\" ]]
+    [[ "$output" =~ \"action\":\"fail\",\"state\":\"failed\",\"started_at\":[0-9]+,\"exit_code\":3 ]]
+    [[ "$output" =~ \"action\":\"snapshot\",\"state\":\"running\" ]]
+}
+
+@test "Recent results of menu batches carry the phase timestamps of the run" {
+    if ! script -qec true /dev/null >/dev/null 2>&1; then
+        skip "util-linux 'script' is required to emulate a terminal"
+    fi
+    run bash -c "(sleep 1; printf '+'; sleep 0.3; printf '\r'; sleep 3; printf 'q'; sleep 0.5; printf '\033'; sleep 0.3) | PATH='$FAKE_BIN':\"\$PATH\" script -qec \"stty cols 200; bash '$SHELL_BUN' --status-socket '$SOCKET' '$TEST_CONFIG'\" /dev/null"
+    [ "$status" -eq 0 ]
+    run cat "$BATS_TEST_TMPDIR"/logs/*_App_snapshot.log
+    [[ "$output" =~ \"action\":\"first\",\"exit_code\":0,\"finished_at\":[0-9]+,\"duration_seconds\":[0-9]+,\"phases\":\{\"built\":[0-9.]+,\"started\":[0-9.]+,\"first_output\":[0-9.]+,\"exited\":[0-9.]+,\"closed\":[0-9.]+\}\} ]]
+    # An action without output has no first_output
+    [[ "$output" =~ \"action\":\"fail\",[^}]*\"phases\":\{\"built\":[0-9.]+,\"started\":[0-9.]+,\"exited\":[0-9.]+,\"closed\":[0-9.]+\}\} ]]
+}
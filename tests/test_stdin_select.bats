@@ -0,0 +1,58 @@
+#!/usr/bin/env bats
+
+# Test running selections piped to stdin (--stdin-select)
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_FIXTURES="$SCRIPT_DIR/tests/fixtures"
+}
+
+@test "--stdin-select runs the actions of every line with CI output" {
+    run bash -c "printf 'TestApp1 build\nTestApp2 deploy\n' | bash '$SHELL_BUN' --stdin-select '$TEST_FIXTURES/basic.cfg'"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Selection: 2 line(s) from stdin" ]]
+    [[ "$output" =~ "Building TestApp1" ]]
+    [[ "$output" =~ "Deploying TestApp2" ]]
+    [[ "$output" =~ "All operations completed successfully" ]]
+    [[ ! "$output" =~ "requires an interactive terminal" ]]
+}
+
+@test "--stdin-select accepts patterns, comments and blank lines and runs each action once" {
+    run bash -c "printf '# nightly\n\nTest* build\nTestApp1 build,test\n' | bash '$SHELL_BUN' --stdin-select '$TEST_FIXTURES/basic.cfg'"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Selection: 2 line(s) from stdin" ]]
+    [[ "$output" =~ "Commands executed: 3" ]]
+    [ "$(echo "$output" | grep -c "Starting: TestApp1 - build")" -eq 1 ]
+    [[ "$output" =~ "Building TestApp2" ]]
+    [[ "$output" =~ "Testing TestApp1" ]]
+}
+
+@test "--stdin-select reports malformed lines with their line numbers before running anything" {
+    run bash -c "printf 'TestApp1 build\nbogus\nNope build\nTestApp1 zzz\nTestApp1 build extra\n' | bash '$SHELL_BUN' --stdin-select '$TEST_FIXTURES/basic.cfg'"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "Error: stdin line 2: expected 'APP_PATTERN ACTION_PATTERN', got 'bogus'" ]]
+    [[ "$output" =~ "Error: stdin line 3: no applications match 'Nope'" ]]
+    [[ "$output" =~ "Error: stdin line 4: no actions of TestApp1 match 'zzz'" ]]
+    [[ "$output" =~ "Error: stdin line 5: expected 'APP_PATTERN ACTION_PATTERN', got 'TestApp1 build extra'" ]]
+    [[ "$output" =~ "Nothing was run." ]]
+    [[ ! "$output" =~ "Building TestApp1" ]]
+}
+
+@test "--stdin-select fails without any selection" {
+    run bash -c "printf '# nothing\n' | bash '$SHELL_BUN' --stdin-select '$TEST_FIXTURES/basic.cfg'"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "read no selections from stdin" ]]
+}
+
+@test "--stdin-select works with CI options" {
+    run bash -c "printf 'TestApp1 build,test\n' | bash '$SHELL_BUN' --stdin-select --explain '$TEST_FIXTURES/basic.cfg'"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Execution plan for 2 action(s):" ]]
+
+    run bash -c "printf 'TestApp1 build\n' | bash '$SHELL_BUN' --stdin-select --ci TestApp1 build '$TEST_FIXTURES/basic.cfg'"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "cannot be combined with --ci" ]]
+}
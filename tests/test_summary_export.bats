@@ -0,0 +1,101 @@
+#!/usr/bin/env bats
+
+# Test copying a plain-text run summary from the log viewer
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_CONFIG="$BATS_TEST_TMPDIR/summary.cfg"
+    LOG_DIR="$BATS_TEST_TMPDIR/logs"
+    CLIPBOARD_FILE="$BATS_TEST_TMPDIR/clipboard.txt"
+
+    # The interactive UI needs a terminal; util-linux 'script' provides one
+    if ! script -qec true /dev/null >/dev/null 2>&1; then
+        skip "util-linux 'script' is required to emulate a terminal"
+    fi
+
+    cat > "$TEST_CONFIG" << EOF
+log_dir=$LOG_DIR
+
+[Portal]
+build=echo "Building Portal"
+test=echo "Testing Portal"; exit 2
+EOF
+}
+
+# Select every action, run them, then feed the given log viewer keys
+run_batch_then_keys() {
+    local keys="$1"
+    run bash -c "export SHELL_BUN_CLIPBOARD_COMMAND='cat > \"$CLIPBOARD_FILE\"'; (sleep 1; printf '+'; sleep 0.3; printf '\r'; sleep 2; printf '$keys'; sleep 0.5; printf 'q'; sleep 0.3; printf '\033'; sleep 0.3) | script -qec \"stty cols 200; bash '$SHELL_BUN' '$TEST_CONFIG'\" /dev/null"
+}
+
+@test "Execution summary lists each action with duration and exit code" {
+    run_batch_then_keys ''
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "✔ Portal build "[0-9]+m?s ]]
+    [[ "$output" =~ "✘ Portal test "[0-9]+m?s" (exit 2)" ]]
+}
+
+@test "c copies a plain-text summary and writes summary.txt next to the logs" {
+    run_batch_then_keys 'c'
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Summary copied via cat > " ]]
+    [[ "$output" =~ "saved to $LOG_DIR/summary.txt" ]]
+    [ -f "$CLIPBOARD_FILE" ]
+    cmp "$CLIPBOARD_FILE" "$LOG_DIR/summary.txt"
+    grep -q '^Shell-Bun run .*: 1 succeeded, 1 failed$' "$CLIPBOARD_FILE"
+    grep -q '^✘ Portal test [0-9]*m\?s (exit 2)$' "$CLIPBOARD_FILE"
+    grep -q '^✔ Portal build [0-9]*m\?s$' "$CLIPBOARD_FILE"
+    # Plain text only: no escape sequences
+    [ "$(grep -c $'\033' "$CLIPBOARD_FILE")" -eq 0 ]
+}
+
+@test "Failures are tagged with their classification in the summary" {
+    cat > "$TEST_CONFIG" << EOF
+log_dir=$LOG_DIR
+classify.test=exit 2|FAILED
+
+[Portal]
+build=echo "Building Portal"
+test=echo "2 tests FAILED"; exit 2
+EOF
+    run_batch_then_keys 'c'
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "FAILED: Portal - test ("[^$'\n']*"[test]" ]]
+    grep -q '^✘ Portal test [0-9]*m\?s (exit 2) \[test\]$' "$CLIPBOARD_FILE"
+}
+
+@test "Extracted fields follow the duration in the summary" {
+    cat > "$TEST_CONFIG" << EOF
+log_dir=$LOG_DIR
+
+[Portal]
+build=echo "Building Portal"
+test=echo "PASSED: 412 FAILED: 3"; exit 2
+test.extract.passed=PASSED: (\d+)
+test.extract.failed=FAILED: (\d+)
+EOF
+    run_batch_then_keys 'c'
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "✘ Portal test "[0-9]+m?s" passed=412 failed=3 (exit 2)" ]]
+    grep -q '^✘ Portal test [0-9]*m\?s passed=412 failed=3 (exit 2)$' "$CLIPBOARD_FILE"
+}
+
+@test "n attaches a note to a result that is kept next to its log and copied" {
+    run_batch_then_keys 'nknown flaky, see JIRA-123\r'
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Note for Portal - test (empty removes it):" ]]
+    [[ "$output" =~ "FAILED: Portal - test ("[^$'\n']*"📝" ]]
+    [[ "$output" =~ "📝 Note: known flaky, see JIRA-123" ]]
+    run cat "$LOG_DIR"/*_Portal_test.log.note
+    [ "$output" = "known flaky, see JIRA-123" ]
+
+    # The copied summary carries the note; clearing the note (Ctrl+U) removes it
+    rm "$LOG_DIR"/*.note
+    run bash -c "export SHELL_BUN_CLIPBOARD_COMMAND='cat > \"$CLIPBOARD_FILE\"'; (sleep 1; printf '+'; sleep 0.3; printf '\r'; sleep 2; printf 'nflaky\r'; sleep 0.5; printf 'c'; sleep 0.5; printf 'n\025\r'; sleep 0.5; printf 'q'; sleep 0.3; printf '\033'; sleep 0.3) | script -qec \"stty cols 200; bash '$SHELL_BUN' '$TEST_CONFIG'\" /dev/null"
+    [ "$status" -eq 0 ]
+    grep -q '^✘ Portal test [0-9]*m\?s (exit 2) 📝 flaky$' "$CLIPBOARD_FILE"
+    [ "$(find "$LOG_DIR" -name '*.note' | wc -l)" -eq 0 ]
+}
@@ -0,0 +1,78 @@
+#!/usr/bin/env bats
+
+# Test tagging runs (--tag and t in the log viewer)
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_CONFIG="$BATS_TEST_TMPDIR/tags.cfg"
+    LOG_DIR="$BATS_TEST_TMPDIR/logs"
+    STATE_DIR="$BATS_TEST_TMPDIR/state"
+
+    cat > "$TEST_CONFIG" << EOF
+log_dir=$LOG_DIR
+
+[Portal]
+build=echo "Building Portal"
+test=echo "Testing Portal"; exit 2
+EOF
+}
+
+# Select every action, run them, then feed the given log viewer keys
+run_batch_then_keys() {
+    local keys="$1"
+    shift
+    run bash -c "export SHELL_BUN_CLIPBOARD_COMMAND='cat > \"$BATS_TEST_TMPDIR/clipboard.txt\"'; (sleep 1; printf '+'; sleep 0.3; printf '\r'; sleep 2; printf '$keys'; sleep 0.5; printf 'q'; sleep 0.3; printf '\033'; sleep 0.3) | script -qec \"stty cols 200; bash '$SHELL_BUN' --state-dir '$STATE_DIR' $* '$TEST_CONFIG'\" /dev/null"
+}
+
+@test "--tag rejects empty names and names with whitespace or commas" {
+    for tag in "" "two words" "a,b"; do
+        run bash "$SHELL_BUN" --ci Portal build --tag "$tag" "$TEST_CONFIG"
+        [ "$status" -eq 1 ]
+        [[ "$output" =~ "Error: --tag requires a tag name without whitespace or commas" ]]
+    done
+}
+
+@test "--tag is shown in the CI header and is in every JSON result" {
+    run bash -c "bash '$SHELL_BUN' --state-dir '$STATE_DIR' --ci Portal all --tag nightly --tag=release-2.4 --tag nightly --output json '$TEST_CONFIG' 2>'$BATS_TEST_TMPDIR/stderr'"
+    [ "$status" -eq 1 ]
+    grep -qx 'Tags: nightly, release-2.4' "$BATS_TEST_TMPDIR/stderr"
+    [ "$(grep -c '"tags":\["nightly","release-2.4"\]}' <<< "$output")" -eq 2 ]
+    # Tags given on the command line are remembered for completion
+    [ "$(cat "$STATE_DIR"/*/run_tags)" = $'nightly\nrelease-2.4' ]
+}
+
+@test "--tag adds tag properties to every JUnit suite" {
+    run bash -c "bash '$SHELL_BUN' --state-dir '$STATE_DIR' --ci Portal all --tag 'a<b' --output junit '$TEST_CONFIG' 2>/dev/null"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "    <properties>"$'\n'"      <property name=\"tag\" value=\"a&lt;b\"/>"$'\n'"    </properties>"$'\n'"    <testcase" ]]
+}
+
+@test "--tag tags the logs of interactive runs" {
+    if ! script -qec true /dev/null >/dev/null 2>&1; then
+        skip "util-linux 'script' is required to emulate a terminal"
+    fi
+    run_batch_then_keys 'c' --tag nightly
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Tags: nightly" ]]
+    [ "$(cat "$LOG_DIR"/*_Portal_build.log.tags)" = "nightly" ]
+    [ "$(cat "$LOG_DIR"/*_Portal_test.log.tags)" = "nightly" ]
+    [ "$(cat "$LOG_DIR"/*_batch.log.tags)" = "nightly" ]
+    grep -qx '\[shell-bun\] Tags: nightly' "$LOG_DIR"/*_batch.log
+    grep -qx 'Tags: nightly' "$BATS_TEST_TMPDIR/clipboard.txt"
+}
+
+@test "t tags every log of the run, completing tags used before with Tab" {
+    if ! script -qec true /dev/null >/dev/null 2>&1; then
+        skip "util-linux 'script' is required to emulate a terminal"
+    fi
+    bash "$SHELL_BUN" --state-dir "$STATE_DIR" --ci Portal build --tag nightly "$TEST_CONFIG" >/dev/null
+    run_batch_then_keys 'tnig\t rc1\r'
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Tags used before (Tab completes): nightly" ]]
+    [[ "$output" =~ "Tags: nightly, rc1" ]]
+    [ "$(cat "$LOG_DIR"/*_Portal_test.log.tags | tail -n 1)" = "nightly rc1" ]
+    [ "$(cat "$STATE_DIR"/*/run_tags)" = $'nightly\nrc1' ]
+}
@@ -0,0 +1,102 @@
+#!/usr/bin/env bats
+
+# Test following the latest log of an action with --tail
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_CONFIG="$BATS_TEST_TMPDIR/tail.cfg"
+    LOG_DIR="$BATS_TEST_TMPDIR/logs"
+    mkdir -p "$LOG_DIR"
+
+    cat > "$TEST_CONFIG" << EOF
+log_dir=$LOG_DIR
+
+[Portal]
+build=echo "Building Portal"
+test=echo "Testing Portal"
+
+[PortalAdmin]
+build=echo "Building PortalAdmin"
+EOF
+}
+
+@test "--tail prints the most recent log of the action and exits at its footer" {
+    printf 'older run\n[shell-bun] Finished with exit code 0 at 2026-01-01 00:00:00\n' > "$LOG_DIR/20260101_000000_Portal_test.log"
+    printf 'newer run\n[shell-bun] Finished with exit code 2 at 2026-01-02 00:00:00\n' > "$LOG_DIR/20260102_000000_Portal_test.log"
+    run bash "$SHELL_BUN" --tail Portal test "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "newer run" ]]
+    [[ "$output" =~ "Finished with exit code 2" ]]
+    [[ ! "$output" =~ "older run" ]]
+}
+
+@test "--tail keeps following a log while it grows" {
+    local log="$LOG_DIR/20260102_000000_Portal_test.log"
+    echo "first line" > "$log"
+    (sleep 1; echo "second line" >> "$log"; sleep 1; echo "[shell-bun] Finished with exit code 0 at now" >> "$log") &
+    run bash "$SHELL_BUN" --tail Portal test "$TEST_CONFIG"
+    wait
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "first line"$'\n'"second line"$'\n'"[shell-bun] Finished with exit code 0" ]]
+}
+
+@test "--tail writes only the log to stdout" {
+    printf 'only the log\n[shell-bun] Finished with exit code 0 at now\n' > "$LOG_DIR/20260102_000000_Portal_test.log"
+    run bash -c "bash '$SHELL_BUN' --tail Portal test '$TEST_CONFIG' 2>/dev/null"
+    [ "$status" -eq 0 ]
+    [ "$output" = $'only the log\n[shell-bun] Finished with exit code 0 at now' ]
+}
+
+@test "--tail refuses patterns matching several actions without --all" {
+    run bash "$SHELL_BUN" --tail 'Portal*' build "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "matches 2 actions" ]]
+    [[ "$output" =~ "Portal - build" ]]
+    [[ "$output" =~ "PortalAdmin - build" ]]
+    [[ "$output" =~ "--all" ]]
+}
+
+@test "--tail --all follows every matching action with a prefix" {
+    printf 'portal\n[shell-bun] Finished with exit code 0 at now\n' > "$LOG_DIR/20260102_000000_Portal_build.log"
+    printf 'admin\n[shell-bun] Finished with exit code 1 at now\n' > "$LOG_DIR/20260102_000000_PortalAdmin_build.log"
+    run bash "$SHELL_BUN" --tail 'Portal*' build --all "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "[Portal - build] portal" ]]
+    [[ "$output" =~ "[PortalAdmin - build] admin" ]]
+}
+
+@test "--tail reports actions without logs" {
+    run bash "$SHELL_BUN" --tail PortalAdmin build "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "No logs found for PortalAdmin - build" ]]
+}
+
+@test "--tail requires an application and an action" {
+    run bash "$SHELL_BUN" --tail Portal
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "--tail requires an application and an action pattern" ]]
+    run bash "$SHELL_BUN" --tail=Portal
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "--tail requires an application and an action pattern" ]]
+}
+
+@test "--tail=APP takes the action pattern as the next argument" {
+    printf 'newer run\n[shell-bun] Finished with exit code 0 at now\n' > "$LOG_DIR/20260102_000000_Portal_test.log"
+    run bash "$SHELL_BUN" --tail=Portal test "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "newer run" ]]
+}
+
+@test "Logs of interactive runs end with a footer" {
+    if ! script -qec true /dev/null >/dev/null 2>&1; then
+        skip "util-linux 'script' is required to emulate a terminal"
+    fi
+    run bash -c "(sleep 1; printf '\033[B'; sleep 0.3; printf ' '; sleep 0.3; printf '\r'; sleep 1.5; printf '\033'; sleep 0.5; printf '\033'; sleep 0.3) | script -qec \"bash '$SHELL_BUN' '$TEST_CONFIG'\" /dev/null"
+    run bash "$SHELL_BUN" --tail Portal test "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Testing Portal" ]]
+    [[ "$output" =~ "[shell-bun] Finished with exit code 0" ]]
+}
@@ -0,0 +1,75 @@
+#!/usr/bin/env bats
+
+# Test color and symbol degradation on limited terminals
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_FIXTURES="$SCRIPT_DIR/tests/fixtures"
+    GOLDEN="$TEST_FIXTURES/golden"
+    OUTPUT="$BATS_TEST_TMPDIR/output.txt"
+    # Run from the fixtures dir so the snapshots contain relative config paths
+    cd "$TEST_FIXTURES"
+}
+
+# Collapse action durations so the snapshots are stable
+normalize() {
+    sed -E 's/\([0-9]+m?s\)/(Ns)/'
+}
+
+@test "Profile: full validate output matches the golden snapshot" {
+    bash "$SHELL_BUN" --force-profile full --validate control_chars.cfg > "$OUTPUT" 2>&1
+    diff -u "$GOLDEN/profile_full_validate.txt" "$OUTPUT"
+}
+
+@test "Profile: plain validate output matches the golden snapshot" {
+    bash "$SHELL_BUN" --force-profile plain --validate control_chars.cfg > "$OUTPUT" 2>&1
+    diff -u "$GOLDEN/profile_plain_validate.txt" "$OUTPUT"
+}
+
+@test "Profile: full CI output matches the golden snapshot" {
+    bash "$SHELL_BUN" --force-profile full --ci FailApp fail_command error.cfg 2>&1 | normalize > "$OUTPUT"
+    diff -u "$GOLDEN/profile_full_ci.txt" "$OUTPUT"
+}
+
+@test "Profile: plain CI output matches the golden snapshot" {
+    bash "$SHELL_BUN" --force-profile plain --ci FailApp fail_command error.cfg 2>&1 | normalize > "$OUTPUT"
+    diff -u "$GOLDEN/profile_plain_ci.txt" "$OUTPUT"
+}
+
+@test "Profile: TERM=dumb drops colors and Unicode" {
+    TERM=dumb run bash "$SHELL_BUN" --ci TestApp1 build basic.cfg
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "[OK] Completed: TestApp1 - build" ]]
+    [[ ! "$output" =~ $'\033[' ]]
+    [[ ! "$output" =~ "✅" ]]
+}
+
+@test "Profile: NO_COLOR keeps Unicode but drops colors" {
+    NO_COLOR=1 run bash "$SHELL_BUN" --ci TestApp1 build basic.cfg
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "✅ Completed: TestApp1 - build" ]]
+    [[ ! "$output" =~ $'\033[' ]]
+}
+
+@test "Profile: non-UTF-8 locale falls back to ASCII symbols" {
+    LC_ALL=C run bash "$SHELL_BUN" --ci TestApp1 build basic.cfg
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "[OK] Completed: TestApp1 - build" ]]
+    [[ "$output" =~ $'\033[' ]]
+}
+
+@test "Profile: --force-profile rejects unknown profiles" {
+    run bash "$SHELL_BUN" --force-profile fancy --ci TestApp1 build basic.cfg
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "--force-profile requires one of: full, ascii, nocolor, plain" ]]
+}
+
+@test "Profile: --doctor reports the detected profile and reason" {
+    TERM=dumb run bash "$SHELL_BUN" --doctor basic.cfg
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Profile:      plain (TERM=dumb has no color or Unicode support)" ]]
+    [[ "$output" =~ "Config:       basic.cfg (found)" ]]
+}
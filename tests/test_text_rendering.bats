@@ -0,0 +1,113 @@
+#!/usr/bin/env bats
+
+# Test the width-aware text rendering helpers and the views built on them
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_CONFIG="$BATS_TEST_TMPDIR/render.cfg"
+
+    # Load just the helpers; sourcing the whole script would start the UI
+    eval "$(sed -n '/^# Text rendering helpers/,/^# Debug logging function/p' "$SHELL_BUN")"
+    SYM_ELLIPSIS="…"
+    SYM_ELLIPSIS_WIDTH=1
+
+    TRICKY_STRINGS=(
+        "plain ascii text"
+        "日本語のテキストと漢字"
+        "한국어 텍스트"
+        "e$(printf '́')le$(printf '̀')ve na$(printf '̈')ive"
+        $'\033[1;33mcolored\033[0m text'
+        '\033[0;36mliteral escapes\033[0m'
+        "emoji 🚀 build ✅ done ❌"
+        "family 👨‍👩‍👧 and flag 🇸🇪"
+        "mixed 日本 é 🚀 \033[2mdim\033[0m end"
+    )
+}
+
+@test "Widths: escape codes, wide and combining characters" {
+    [ "$(text_width "abc")" -eq 3 ]
+    [ "$(text_width "日本語")" -eq 6 ]
+    [ "$(text_width "e$(printf '́')")" -eq 1 ]
+    [ "$(text_width $'\033[31mred\033[0m')" -eq 3 ]
+    [ "$(text_width '\033[1;33mhi\033[0m')" -eq 2 ]
+    [ "$(text_width "✅ ok")" -eq 5 ]
+    [ "$(text_width "👨‍👩‍👧")" -eq 2 ]
+    [ "$(text_width "🇸🇪")" -eq 2 ]
+}
+
+@test "Widths do not depend on the locale" {
+    local text="mixed 日本 é 🚀"
+    [ "$(LC_ALL=C text_width "$text")" -eq 15 ]
+    [ "$(text_width "$text")" -eq 15 ]
+}
+
+@test "Truncated text never exceeds the requested width" {
+    local text max width
+    for text in "${TRICKY_STRINGS[@]}"; do
+        for ((max = 0; max <= 30; max++)); do
+            width=$(text_width "$(truncate_text "$text" "$max")")
+            if [ "$width" -gt "$max" ]; then
+                echo "'$text' truncated to $max is $width columns wide"
+                return 1
+            fi
+        done
+    done
+}
+
+@test "Truncation keeps short text and marks cut text with an ellipsis" {
+    [ "$(truncate_text "short" 10)" = "short" ]
+    [ "$(truncate_text "abcdefghij" 5)" = "abcd…" ]
+    # A wide character that does not fit is dropped whole
+    [ "$(truncate_text "日本語" 4)" = "日…" ]
+    # Combining marks stay with their letter
+    [ "$(truncate_text "e$(printf '́')xyz" 2)" = "e$(printf '́')…" ]
+    # Escape sequences before the cut are kept
+    [ "$(truncate_text $'\033[32mhello world' 6)" = $'\033[32mhello…' ]
+}
+
+@test "Padded text is exactly the requested width" {
+    local text width
+    for text in "${TRICKY_STRINGS[@]}"; do
+        for width in 1 5 12 40; do
+            [ "$(text_width "$(pad_text "$text" "$width")")" -eq "$width" ]
+        done
+    done
+}
+
+@test "Highlighting a range keeps the visible text and width" {
+    [ "$(highlight_range "App - build" 6 5 '<' '>')" = "App - <build>" ]
+    [ "$(highlight_range "日本 build" 5 5 '<' '>')" = "日本 <build>" ]
+    local text
+    for text in "${TRICKY_STRINGS[@]}"; do
+        [ "$(text_width "$(highlight_range "$text" 2 4 $'\033[4m' $'\033[24m')")" -eq "$(text_width "$text")" ]
+    done
+}
+
+@test "Menu lines fit a narrow terminal with wide and combining names" {
+    if ! script -qec true /dev/null >/dev/null 2>&1; then
+        skip "util-linux 'script' is required to emulate a terminal"
+    fi
+    if [ "$(printf '日' | LC_ALL=C.UTF-8 wc -L 2>/dev/null)" != "2" ]; then
+        skip "wc -L with a UTF-8 locale is required to measure display widths"
+    fi
+    cat > "$TEST_CONFIG" << EOF
+log_dir=$BATS_TEST_TMPDIR/logs
+
+[日本語アプリケーション]
+ビルドとテストと配備の長いアクション=echo 🚀 build
+e$(printf '́')le$(printf '̀')ve_with_a_very_long_action_name=echo ok
+
+[🚀 Rocket ✅ App]
+deploy_to_production_everywhere_at_once=echo deploy
+EOF
+    run bash -c "(sleep 1.5; printf '\033') | script -qec \"stty cols 40 rows 24; bash '$SHELL_BUN' --no-trust-check '$TEST_CONFIG'\" /dev/null"
+    [ "$status" -eq 0 ]
+    # Measure the UI only: startup messages before the title box scroll like any output
+    local widest
+    widest=$(printf '%s\n' "$output" | sed -E $'s/\033\\[[0-9;?]*[A-Za-z]//g; s/\r//g' | sed -n '/Shell-Bun by/,$p' | LC_ALL=C.UTF-8 wc -L)
+    [[ "$output" =~ "日本語アプリケーション - ビルド" ]]
+    [ "$widest" -le 40 ]
+}
@@ -0,0 +1,124 @@
+#!/usr/bin/env bats
+
+# Test the per-app timeout that stops hung actions
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_CONFIG="$BATS_TEST_TMPDIR/timeout.cfg"
+    LOG_DIR="$BATS_TEST_TMPDIR/logs"
+
+    cat > "$TEST_CONFIG" << EOF
+log_dir=$LOG_DIR
+
+[Slow]
+timeout=2s
+hang=echo "started"; sleep 30; echo "never printed"
+stubborn=trap '' TERM; echo "started"; sleep 30
+quick=echo "quick done"
+
+[Unlimited]
+wait=sleep 3; echo "waited"
+EOF
+}
+
+@test "An action running longer than its app's timeout is stopped" {
+    local started=$SECONDS
+    run bash "$SHELL_BUN" --ci Slow hang "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [ $((SECONDS - started)) -lt 10 ]
+    [[ "$output" =~ "[shell-bun] Action timed out after 2s (SIGTERM sent)" ]]
+    [[ "$output" =~ "Timed out: Slow - hang" ]]
+    [[ ! "$output" =~ "never printed" ]]
+    [[ ! "$output" =~ "Command failed with exit code" ]]
+}
+
+@test "Actions that ignore SIGTERM are killed after the grace period" {
+    local started=$SECONDS
+    run bash "$SHELL_BUN" --ci Slow stubborn "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [ $((SECONDS - started)) -lt 15 ]
+    [[ "$output" =~ "Timed out: Slow - stubborn" ]]
+}
+
+@test "The CI summary lists timed-out actions apart from other failures" {
+    run bash "$SHELL_BUN" --ci Slow,Unlimited hang,quick,wait "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "quick done" ]]
+    [[ "$output" =~ "waited" ]]
+    [[ "$output" =~ "Successful operations: 2" ]]
+    [[ "$output" =~ "  - Slow - hang (timed out after 2s)" ]]
+}
+
+@test "--output reports mark timed-out actions apart from failed ones" {
+    run bash -c "bash '$SHELL_BUN' --ci Slow hang --output json '$TEST_CONFIG' 2>/dev/null"
+    [ "$status" -eq 1 ]
+    [[ "${lines[1]}" =~ \"exit_code\":124,\"error\":\"timed\ out\ after\ 2s\",\"timed_out\":true, ]]
+    cat >> "$TEST_CONFIG" << 'EOF'
+fail=exit 3
+EOF
+    run bash -c "bash '$SHELL_BUN' --ci Slow,Unlimited hang,fail --output junit '$TEST_CONFIG' 2>/dev/null"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ '<failure message="timed out after 2s" type="timeout"/>' ]]
+    [[ "$output" =~ '<failure message="exit code 3" type="exit code 3"/>' ]]
+}
+
+@test "A command exiting with 124 itself is a failure, not a timeout" {
+    sed -i 's/^quick=.*/&\nexit124=exit 124/' "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --ci Slow exit124 "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "Command failed with exit code 124" ]]
+    [[ ! "$output" =~ "timed out" ]]
+    run bash -c "bash '$SHELL_BUN' --ci Slow exit124 --output json '$TEST_CONFIG' 2>/dev/null"
+    [[ "${lines[1]}" =~ \"exit_code\":124,\"error\":\"exit\ code\ 124\",\"timed_out\":false, ]]
+}
+
+@test "Invalid timeouts are reported and ignored" {
+    sed -i 's/^timeout=2s$/timeout=soon/' "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --ci Slow quick "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Ignoring invalid timeout 'soon' in [Slow]" ]]
+}
+
+@test "Interactive runs show timed-out actions in the summary and log" {
+    if ! script -qec true /dev/null >/dev/null 2>&1; then
+        skip "util-linux 'script' is required to emulate a terminal"
+    fi
+    sed -i '/^stubborn=/d' "$TEST_CONFIG"
+    run bash -c "(sleep 1; printf '+'; sleep 0.3; printf '\r'; sleep 4.5; printf 'q'; sleep 0.3; printf '\033'; sleep 0.3) | script -qec \"stty cols 200; bash '$SHELL_BUN' '$TEST_CONFIG'\" /dev/null"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Slow hang 2s (timed out after 2s)" ]]
+    [[ "$output" =~ "FAILED: Slow - hang [TIMEOUT]" ]]
+    grep -q '^\[shell-bun\] Finished with exit code 124 ' "$LOG_DIR"/*_Slow_hang.log
+}
+
+@test "Global, app and action timeouts override each other" {
+    cat > "$TEST_CONFIG" << EOF
+timeout=2s
+
+[Inherits]
+slow=sleep 10
+
+[Overrides]
+timeout=0
+slow=sleep 3; echo "no limit"
+quick=sleep 3; echo "never printed"
+quick.timeout=1s
+EOF
+    run bash "$SHELL_BUN" --ci Inherits,Overrides slow,quick "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "no limit" ]]
+    [[ ! "$output" =~ "never printed" ]]
+    [[ "$output" =~ "  - Inherits - slow (timed out after 2s)" ]]
+    [[ "$output" =~ "  - Overrides - quick (timed out after 1s)" ]]
+    [[ "$output" =~ "Successful operations: 1" ]]
+}
+
+@test "Timeouts of unknown actions are reported" {
+    echo "missing.timeout=1m" >> "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --ci Slow quick "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "[Unlimited] missing.timeout: no action named 'missing'" ]]
+}
@@ -0,0 +1,174 @@
+#!/usr/bin/env bats
+
+# Test TOML configs: read like the INI format (.toml, or --config-format toml)
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    WORK_DIR="$BATS_TEST_TMPDIR/work"
+    mkdir -p "$WORK_DIR"
+
+    # The same configuration in both formats
+    cat > "$BATS_TEST_TMPDIR/same.cfg" << EOF
+log_dir=$BATS_TEST_TMPDIR/logs
+env_MODE=release
+var_ROOT=$WORK_DIR
+
+[Web]
+working_dir=\${ROOT}
+shell=bash
+env_PORT=8080
+build=echo "web: built" # kept
+test=npm test
+test.depends_on=build,lint
+lint=echo lint
+
+[Api]
+log_dir=$BATS_TEST_TMPDIR/api-logs
+build=make
+build.retries=2
+deploy=./deploy.sh 'prod'
+EOF
+    cat > "$BATS_TEST_TMPDIR/same.toml" << EOF
+# Shell-Bun configuration
+log_dir = "$BATS_TEST_TMPDIR/logs"
+
+[env]
+MODE = 'release'
+
+[vars]
+ROOT = "$WORK_DIR"
+
+[[apps]]
+name = "Web"
+working_dir = '\${ROOT}'
+shell = "bash"
+env = { PORT = 8080 }
+
+[apps.actions]
+build = 'echo "web: built" # kept'
+test = "npm test"   # a comment
+test.depends_on = [
+    "build",  # first
+    "lint",
+]
+lint = "echo lint"
+
+[[apps]]
+name = "Api"
+log_dir = "$BATS_TEST_TMPDIR/api-logs"
+
+[[apps.actions]]
+name = "build"
+command = "make"
+retries = 2
+
+[[apps.actions]]
+command = """
+./deploy.sh 'prod'"""
+name = "deploy"
+EOF
+}
+
+# Function to run shell-bun.sh and print its output without the config file name and times
+run_normalized() {
+    bash "$SHELL_BUN" --no-trust-check "$@" 2>&1 | sed -e 's/same\.\(cfg\|toml\)/CONFIG/g' -e 's/ ([0-9]*m\?s)//' -e '/^Total time: /d'
+}
+
+@test "TOML: lists and runs the same apps and commands as the INI config" {
+    run run_normalized --list "*" "$BATS_TEST_TMPDIR/same.cfg"
+    local ini="$output"
+    run run_normalized --list "*" "$BATS_TEST_TMPDIR/same.toml"
+    [ "$status" -eq 0 ]
+    [ "$output" == "$ini" ]
+    [[ "$output" =~ "Api	deploy" ]]
+
+    run run_normalized --ci "*" "*" --dry-run --sequential "$BATS_TEST_TMPDIR/same.cfg"
+    ini="$output"
+    run run_normalized --ci "*" "*" --dry-run --sequential "$BATS_TEST_TMPDIR/same.toml"
+    [ "$output" == "$ini" ]
+    [[ "$output" =~ "cd '$WORK_DIR' && bash -c export\\ MODE=\\'release\\'\;\\ export\\ PORT=\\'8080\\'\;\\ echo\\ \\\"web:\\ built\\\"\\ #\\ kept" ]]
+}
+
+@test "TOML: validates like the INI config, with lines of the TOML file" {
+    run run_normalized --validate "$BATS_TEST_TMPDIR/same.cfg"
+    local ini
+    ini=$(echo "$output" | sed 's/CONFIG:[0-9]*/CONFIG/')
+    run run_normalized --validate "$BATS_TEST_TMPDIR/same.toml"
+    [ "$(echo "$output" | sed 's/CONFIG:[0-9]*/CONFIG/')" == "$ini" ]
+    [[ "$output" =~ "[Api] deploy: './deploy.sh' not found in $SCRIPT_DIR ($BATS_TEST_TMPDIR/CONFIG:35)" ]]
+}
+
+@test "TOML: --config-format toml and includes between the formats" {
+    cp "$BATS_TEST_TMPDIR/same.toml" "$BATS_TEST_TMPDIR/shell-bun.conf"
+    run bash "$SHELL_BUN" --no-trust-check --config-format toml --list "*" "$BATS_TEST_TMPDIR/shell-bun.conf"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Web	build" ]]
+
+    printf 'include=extra.toml\n[Ini]\nbuild=echo ini\n' > "$BATS_TEST_TMPDIR/main.cfg"
+    printf '[[apps]]\nname = "Toml"\n[apps.actions]\nbuild = "echo toml"\n' > "$BATS_TEST_TMPDIR/extra.toml"
+    run bash "$SHELL_BUN" --no-trust-check --list "*" "$BATS_TEST_TMPDIR/main.cfg"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Ini	build" ]]
+    [[ "$output" =~ "Toml	build" ]]
+}
+
+@test "TOML: commands can span several lines in multi-line strings" {
+    cat > "$BATS_TEST_TMPDIR/multi.toml" << 'EOF'
+[[apps]]
+name = "App"
+[apps.actions]
+build = """
+  # configure first
+  echo configure --prefix=/usr \
+      --enable-shared
+  echo make
+  """
+fold = '''
+echo "literal \n" \
+  two
+'''
+EOF
+    run bash "$SHELL_BUN" --no-trust-check --ci App "*" --sequential "$BATS_TEST_TMPDIR/multi.toml"
+    [ "$status" -eq 0 ]
+    echo "$output" | grep -qx "configure --prefix=/usr --enable-shared"
+    echo "$output" | grep -qx "make"
+    echo "$output" | grep -qx 'literal \\n two'
+}
+
+@test "TOML: what cannot be read is reported with its line" {
+    cat > "$BATS_TEST_TMPDIR/bad.toml" << 'EOF'
+[[apps]]
+name = "App"
+working_dir = make all
+description = """
+two
+lines
+"""
+[apps.actions]
+test = "echo test"
+bad = { x = [1] }
+weird
+[[apps]]
+working_dir = "/tmp"
+[[apps]]
+name = "Other"
+[[apps.actions]]
+name = "lint"
+[[apps.actions]]
+command = "echo nameless"
+EOF
+    run bash "$SHELL_BUN" --no-trust-check --validate "$BATS_TEST_TMPDIR/bad.toml"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "Ignoring working_dir: 'make all' is not a TOML value; quote strings ($BATS_TEST_TMPDIR/bad.toml:3)" ]]
+    [[ "$output" =~ "Ignoring description: only commands can span several lines ($BATS_TEST_TMPDIR/bad.toml:4)" ]]
+    [[ "$output" =~ "Ignoring bad: 'x = [1]' is not a key = value setting with a string, number or boolean ($BATS_TEST_TMPDIR/bad.toml:10)" ]]
+    [[ "$output" =~ "Ignoring line 11: 'weird' is neither a key = value setting nor a [table] ($BATS_TEST_TMPDIR/bad.toml:11)" ]]
+    [[ "$output" =~ "Ignoring an app without a name ($BATS_TEST_TMPDIR/bad.toml:13)" ]]
+    [[ "$output" =~ "[Other] lint: action has no command ($BATS_TEST_TMPDIR/bad.toml:17)" ]]
+    [[ "$output" =~ "Ignoring an action of [Other] without a name ($BATS_TEST_TMPDIR/bad.toml:19)" ]]
+    run bash "$SHELL_BUN" --no-trust-check --list App "$BATS_TEST_TMPDIR/bad.toml"
+    [[ "$output" =~ "App	test" ]]
+}
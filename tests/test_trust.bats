@@ -0,0 +1,92 @@
+#!/usr/bin/env bats
+
+# Test the trust check for configs found in the current directory or named on the command line
+
+setup() {
+    load helpers/common
+    common_setup
+    unset SHELL_BUN_NO_TRUST_CHECK
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_FIXTURES="$SCRIPT_DIR/tests/fixtures"
+    WORK_DIR="$BATS_TEST_TMPDIR/project"
+    export SHELL_BUN_TRUST_STORE="$BATS_TEST_TMPDIR/trusted_configs"
+
+    mkdir -p "$WORK_DIR"
+    cp "$TEST_FIXTURES/basic.cfg" "$WORK_DIR/shell-bun.cfg"
+    cd "$WORK_DIR"
+}
+
+@test "Untrusted default config is refused in CI mode" {
+    run bash "$SHELL_BUN" --ci TestApp1 build
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "is new or has changed since it was last trusted" ]]
+    [[ "$output" =~ "build=echo \"Building TestApp1\"" ]]
+    [[ "$output" =~ "Re-run with --trust" ]]
+    [[ ! "$output" =~ "Completed: TestApp1 - build" ]]
+}
+
+@test "--trust records the config and runs it" {
+    run bash "$SHELL_BUN" --trust --ci TestApp1 build
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Completed: TestApp1 - build" ]]
+    grep -q " $WORK_DIR/shell-bun.cfg$" "$SHELL_BUN_TRUST_STORE"
+
+    run bash "$SHELL_BUN" --ci TestApp1 build
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Completed: TestApp1 - build" ]]
+}
+
+@test "Changing a trusted config requires trusting it again" {
+    run bash "$SHELL_BUN" --trust --ci TestApp1 build
+    [ "$status" -eq 0 ]
+
+    echo "# edited" >> shell-bun.cfg
+    run bash "$SHELL_BUN" --ci TestApp1 build
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "Refusing to run commands from an untrusted configuration" ]]
+
+    run bash "$SHELL_BUN" --trust --ci TestApp1 build
+    [ "$status" -eq 0 ]
+    [ "$(grep -c " $WORK_DIR/shell-bun.cfg$" "$SHELL_BUN_TRUST_STORE")" -eq 1 ]
+}
+
+@test "--no-trust-check and SHELL_BUN_NO_TRUST_CHECK=1 skip the check" {
+    run bash "$SHELL_BUN" --no-trust-check --ci TestApp1 build
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Completed: TestApp1 - build" ]]
+    [ ! -f "$SHELL_BUN_TRUST_STORE" ]
+
+    run env SHELL_BUN_NO_TRUST_CHECK=1 bash "$SHELL_BUN" --ci TestApp1 build
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Completed: TestApp1 - build" ]]
+    [ ! -f "$SHELL_BUN_TRUST_STORE" ]
+}
+
+@test "Explicitly named configs are checked too" {
+    cd "$BATS_TEST_TMPDIR"
+    run bash "$SHELL_BUN" --ci TestApp1 build "$WORK_DIR/shell-bun.cfg"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "Refusing to run commands from an untrusted configuration" ]]
+    [[ ! "$output" =~ "Completed: TestApp1 - build" ]]
+
+    run bash "$SHELL_BUN" --trust --ci TestApp1 build "$WORK_DIR/shell-bun.cfg"
+    [ "$status" -eq 0 ]
+    grep -q " $WORK_DIR/shell-bun.cfg$" "$SHELL_BUN_TRUST_STORE"
+
+    # Trust is recorded per file, whichever way it was loaded
+    cd "$WORK_DIR"
+    run bash "$SHELL_BUN" --ci TestApp1 build
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Completed: TestApp1 - build" ]]
+}
+
+@test "Declining the interactive prompt exits without running" {
+    if ! script -qec true /dev/null >/dev/null 2>&1; then
+        skip "util-linux 'script' is required to emulate a terminal"
+    fi
+    run bash -c "(sleep 1; printf 'n\r') | script -qec \"bash '$SHELL_BUN'\" /dev/null"
+    [[ "$output" =~ "Trust this configuration and run its commands? [y/N]" ]]
+    [[ "$output" =~ "Configuration not trusted - exiting." ]]
+    [ ! -f "$SHELL_BUN_TRUST_STORE" ]
+}
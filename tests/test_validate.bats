@@ -0,0 +1,209 @@
+#!/usr/bin/env bats
+
+# Test configuration validation (--validate)
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_FIXTURES="$SCRIPT_DIR/tests/fixtures"
+    WORK_DIR="$BATS_TEST_TMPDIR/work"
+    TEST_CONFIG="$BATS_TEST_TMPDIR/validate.cfg"
+
+    mkdir -p "$WORK_DIR/scripts"
+    printf '#!/bin/sh\necho ok\n' > "$WORK_DIR/scripts/ok.sh"
+    chmod +x "$WORK_DIR/scripts/ok.sh"
+    printf '#!/bin/sh\n' > "$WORK_DIR/scripts/noexec.sh"
+    chmod -x "$WORK_DIR/scripts/noexec.sh"
+}
+
+write_config() {
+    {
+        echo "[App]"
+        echo "working_dir=$WORK_DIR"
+        cat
+    } > "$TEST_CONFIG"
+}
+
+@test "Validate: clean configuration exits 0" {
+    run bash "$SHELL_BUN" --validate "$TEST_FIXTURES/basic.cfg"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Configuration is valid" ]]
+    # Only the note that its log_dir is created on the first run (unless an earlier test ran it)
+    [ "$(echo "$output" | grep "Warning" | grep -vc "log_dir: .* does not exist yet")" -eq 0 ]
+}
+
+@test "Validate: missing relative script is flagged" {
+    write_config <<'EOF'
+build=./scripts/biuld.sh --fast
+EOF
+    run bash "$SHELL_BUN" --validate "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "[App] build: './scripts/biuld.sh' not found in $WORK_DIR" ]]
+}
+
+@test "Validate: existing executable script is accepted" {
+    write_config <<'EOF'
+build=./scripts/ok.sh
+other=scripts/ok.sh --flag
+EOF
+    run bash "$SHELL_BUN" --validate "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ ! "$output" =~ "Warning" ]]
+}
+
+@test "Validate: non-executable script is flagged" {
+    write_config <<'EOF'
+build=./scripts/noexec.sh
+EOF
+    run bash "$SHELL_BUN" --validate "$TEST_CONFIG"
+    [[ "$output" =~ "'./scripts/noexec.sh' is not executable" ]]
+}
+
+@test "Validate: quoted script path is unwrapped" {
+    write_config <<'EOF'
+build="./scripts/gone.sh" arg
+EOF
+    run bash "$SHELL_BUN" --validate "$TEST_CONFIG"
+    [[ "$output" =~ "'./scripts/gone.sh' not found" ]]
+}
+
+@test "Validate: tokenizer skips commands it cannot judge" {
+    write_config <<'EOF'
+env_assignment=FOO=1 ./scripts/missing.sh
+builtin=cd scripts && ./missing.sh
+source_builtin=source ./scripts/missing.sh
+keyword=if true; then ./scripts/missing.sh; fi
+pipe=| ./scripts/missing.sh
+subshell=(./scripts/missing.sh)
+variable=$TOOLS/missing.sh
+glob=./scripts/*.sh
+path_lookup=make all
+absolute=/nonexistent/tool
+EOF
+    run bash "$SHELL_BUN" --validate "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ ! "$output" =~ "Warning" ]]
+}
+
+@test "Validate: script paths are not checked in container mode" {
+    write_config <<'EOF'
+build=./scripts/biuld.sh
+EOF
+    run bash "$SHELL_BUN" --container "docker exec builder" --validate "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ ! "$output" =~ "Warning" ]]
+    [[ "$output" =~ "script paths are not checked" ]]
+}
+
+@test "Menu shows script warnings when check_scripts is enabled" {
+    if ! script -qec true /dev/null >/dev/null 2>&1; then
+        skip "util-linux 'script' is required to emulate a terminal"
+    fi
+    {
+        echo "check_scripts=true"
+        echo "[App]"
+        echo "working_dir=$WORK_DIR"
+        echo "build=./scripts/biuld.sh"
+        echo "ok=./scripts/ok.sh"
+    } > "$TEST_CONFIG"
+    run bash -c "(sleep 1; printf '\033'; sleep 0.3) | script -qec \"bash '$SHELL_BUN' '$TEST_CONFIG'\" /dev/null"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "App - build"\ .*"⚠ './scripts/biuld.sh' not found" ]]
+    [[ ! "$output" =~ "App - ok"\ .*"⚠" ]]
+}
+
+@test "Validation warns about Windows line endings" {
+    run bash "$SHELL_BUN" --validate "$TEST_FIXTURES/crlf.cfg"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Windows (CRLF) line endings" ]]
+}
+
+@test "Validation warns about values containing control characters" {
+    run bash "$SHELL_BUN" --validate "$TEST_FIXTURES/control_chars.cfg"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "[CtrlApp] build: value contains control characters" ]]
+    [[ "$output" =~ "valid with 1 warning(s)" ]]
+}
+
+@test "Validation warns about invalid extraction rules" {
+    run bash "$SHELL_BUN" --validate "$TEST_FIXTURES/extract.cfg"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "[ExtractApp] broken.extract.count: invalid regex 'count: ([0-9]+'" ]]
+    [[ "$output" =~ "[ExtractApp] missing.extract.count: no action named 'missing'" ]]
+    [ "$(echo "$output" | grep "Warning" | grep -vc "log_dir: .* does not exist yet")" -eq 2 ]
+}
+
+@test "Validation fails on errors and lists each with its location" {
+    write_config <<'EOF2'
+build=echo one
+build=echo two
+empty=
+slow.timeout=forever
+EOF2
+    sed -i "s|^working_dir=.*|working_dir=$BATS_TEST_TMPDIR/gone|" "$TEST_CONFIG"
+    run bash -c "bash '$SHELL_BUN' --validate '$TEST_CONFIG' 2>&1 >/dev/null"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "Error: [App] working_dir: $BATS_TEST_TMPDIR/gone does not exist ($TEST_CONFIG:2)" ]]
+    [[ "$output" =~ "Warning: [App] build: action defined twice, at lines 3 and 4; the second definition is used ($TEST_CONFIG:4)" ]]
+    [[ "$output" =~ "Error: [App] empty: empty command ($TEST_CONFIG:5)" ]]
+    [[ "$output" =~ "Error: Ignoring invalid slow.timeout 'forever' in [App]" ]]
+
+    run bash "$SHELL_BUN" --validate "$TEST_CONFIG"
+    [[ "$output" =~ "Configuration has 3 error(s) and 1 warning(s)" ]]
+}
+
+@test "Validation tells log dirs that are created later from ones that cannot be" {
+    write_config <<EOF2
+log_dir=$BATS_TEST_TMPDIR/logs/new
+build=./scripts/ok.sh
+EOF2
+    run bash "$SHELL_BUN" --validate "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Warning: [App] log_dir: $BATS_TEST_TMPDIR/logs/new does not exist yet; it is created on the first run" ]]
+
+    touch "$BATS_TEST_TMPDIR/file"
+    sed -i "s|^log_dir=.*|log_dir=$BATS_TEST_TMPDIR/file/logs|" "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --validate "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "Error: [App] log_dir: $BATS_TEST_TMPDIR/file/logs cannot be created ($BATS_TEST_TMPDIR/file is not a directory)" ]]
+}
+
+@test "Validation reports lines that are neither sections nor settings" {
+    write_config <<'EOF2'
+build=./scripts/ok.sh
+test ./scripts/ok.sh
+[Other
+EOF2
+    run bash -c "bash '$SHELL_BUN' --check '$TEST_CONFIG' 2>&1 >/dev/null"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "Error: Ignoring line 4: 'test ./scripts/ok.sh' is neither a [Section] nor a key=value setting ($TEST_CONFIG:4)" ]]
+    [[ "$output" =~ "Error: Ignoring line 5: '[Other' is neither" ]]
+
+    run bash "$SHELL_BUN" --check "$TEST_CONFIG"
+    [[ "$output" =~ "Configuration has 2 error(s)" ]]
+}
+
+@test "Validation warns about duplicate sections and apps without actions" {
+    write_config <<'EOF2'
+build=./scripts/ok.sh
+
+[Empty]
+
+[App]
+test=./scripts/ok.sh
+EOF2
+    run bash -c "bash '$SHELL_BUN' --validate '$TEST_CONFIG' 2>&1 >/dev/null"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Warning: [App] section appears twice in this file, at lines 1 and 7; the second adds to the first ($TEST_CONFIG:7)" ]]
+    [[ "$output" =~ "Warning: [Empty] has no actions ($TEST_CONFIG:5)" ]]
+}
+
+@test "Sections of an app in an included config are not duplicates" {
+    printf '[App]\nworking_dir=%s\nbuild=./scripts/ok.sh\n' "$WORK_DIR" > "$BATS_TEST_TMPDIR/base.cfg"
+    printf 'include=base.cfg\n[App]\ntest=./scripts/ok.sh\n' > "$TEST_CONFIG"
+    run bash "$SHELL_BUN" --validate "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [[ ! "$output" =~ "appears twice" ]]
+}
@@ -0,0 +1,81 @@
+#!/usr/bin/env bats
+
+# Test collecting config warnings and showing them in CI mode and the menu
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    TEST_CONFIG="$BATS_TEST_TMPDIR/warnings.cfg"
+    mkdir -p "$BATS_TEST_TMPDIR/logs"
+
+    cat > "$TEST_CONFIG" << EOF
+log_dir=$BATS_TEST_TMPDIR/logs
+menu_colums=2
+
+[Portal]
+working_dir=$BATS_TEST_TMPDIR/missing
+build=echo "Building Portal"
+
+[Docs]
+build=echo "Building Docs"
+EOF
+}
+
+@test "Unknown settings and missing working dirs are reported with their location" {
+    run bash "$SHELL_BUN" --validate "$TEST_CONFIG"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "Unknown setting 'menu_colums' ($TEST_CONFIG:2)" ]]
+    [[ "$output" =~ "[Portal] working_dir: $BATS_TEST_TMPDIR/missing does not exist ($TEST_CONFIG:5)" ]]
+    [[ "$output" =~ "Configuration has 1 error(s) and 1 warning(s)" ]]
+}
+
+@test "CI mode prints the warnings to stderr before running" {
+    run bash -c "bash '$SHELL_BUN' --ci Docs build '$TEST_CONFIG' 2>&1 >/dev/null"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Warning: Unknown setting 'menu_colums'" ]]
+    [[ "$output" =~ "Warning: [Portal] working_dir:" ]]
+
+    run bash "$SHELL_BUN" --ci Docs build "$TEST_CONFIG"
+    local warning_line start_line
+    warning_line=$(echo "$output" | grep -n "Unknown setting" | cut -d: -f1)
+    start_line=$(echo "$output" | grep -n "Starting: Docs - build" | cut -d: -f1)
+    [ "$warning_line" -lt "$start_line" ]
+}
+
+@test "Working dirs are not checked in container mode" {
+    run bash "$SHELL_BUN" --container "docker exec dev" --validate "$TEST_CONFIG"
+    [ "$status" -eq 0 ]
+    [ "$(echo "$output" | grep -c "does not exist")" -eq 0 ]
+    [[ "$output" =~ "Configuration is valid with 1 warning(s)" ]]
+}
+
+@test "Menu shows a warning badge and ! opens the warnings view" {
+    if ! script -qec true /dev/null >/dev/null 2>&1; then
+        skip "util-linux 'script' is required to emulate a terminal"
+    fi
+    run bash -c "(sleep 1; printf '!'; sleep 0.5; printf 'q'; sleep 0.5; printf '\033'; sleep 0.3) | script -qec \"stty cols 200; bash '$SHELL_BUN' '$TEST_CONFIG'\" /dev/null"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "2 config warning(s) - press ! to view" ]]
+    [[ "$output" =~ "Configuration warnings: 2" ]]
+    [[ "$output" =~ "1. Unknown setting 'menu_colums'" ]]
+    [[ "$output" =~ "Only global settings go before the first [App] section" ]]
+    [[ "$output" =~ "Goodbye!" ]]
+}
+
+@test "Menu shows no badge without warnings" {
+    if ! script -qec true /dev/null >/dev/null 2>&1; then
+        skip "util-linux 'script' is required to emulate a terminal"
+    fi
+    cat > "$TEST_CONFIG" << EOF
+log_dir=$BATS_TEST_TMPDIR/logs
+
+[Docs]
+build=echo "Building Docs"
+EOF
+    run bash -c "(sleep 1; printf '!'; sleep 0.3; printf '\177'; sleep 0.3; printf '\033'; sleep 0.3) | script -qec \"stty cols 200; bash '$SHELL_BUN' '$TEST_CONFIG'\" /dev/null"
+    [ "$status" -eq 0 ]
+    [ "$(echo "$output" | grep -c "press ! to view")" -eq 0 ]
+    [ "$(echo "$output" | grep -c "Configuration warnings")" -eq 0 ]
+}
@@ -3,6 +3,8 @@
 # Test working directory functionality
 
 setup() {
+    load helpers/common
+    common_setup
     SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
     SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
     TEST_FIXTURES="$SCRIPT_DIR/tests/fixtures"
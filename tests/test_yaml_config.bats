@@ -0,0 +1,226 @@
+#!/usr/bin/env bats
+
+# Test YAML configs: read like the INI format (.yaml/.yml, or --config-format yaml)
+
+setup() {
+    load helpers/common
+    common_setup
+    SCRIPT_DIR="$(cd "$(dirname "$BATS_TEST_FILENAME")/.." && pwd)"
+    SHELL_BUN="$SCRIPT_DIR/shell-bun.sh"
+    WORK_DIR="$BATS_TEST_TMPDIR/work"
+    mkdir -p "$WORK_DIR"
+
+    # The same configuration in both formats
+    cat > "$BATS_TEST_TMPDIR/same.cfg" << EOF
+log_dir=$BATS_TEST_TMPDIR/logs
+env_MODE=release
+var_ROOT=$WORK_DIR
+
+[Web]
+working_dir=\${ROOT}
+shell=bash
+env_PORT=8080
+build=echo "web: built" # kept
+test=npm test
+test.depends_on=build,lint
+lint=echo lint
+
+[Api]
+log_dir=$BATS_TEST_TMPDIR/api-logs
+build=make
+build.retries=2
+deploy=./deploy.sh 'prod'
+EOF
+    cat > "$BATS_TEST_TMPDIR/same.yaml" << EOF
+# Shell-Bun configuration
+log_dir: $BATS_TEST_TMPDIR/logs
+env:
+  MODE: release
+vars:
+  ROOT: $WORK_DIR
+
+apps:
+  - name: Web
+    working_dir: \${ROOT}
+    shell: bash
+    env:
+      PORT: "8080"
+    actions:
+      build: 'echo "web: built" # kept'
+      test: npm test   # a comment
+      test.depends_on: [build, lint]
+      lint: echo lint
+
+  - name: Api
+    log_dir: $BATS_TEST_TMPDIR/api-logs
+    actions:
+      - name: build
+        command: make
+        retries: 2
+      - command: "./deploy.sh 'prod'"
+        name: deploy
+EOF
+}
+
+# Function to run shell-bun.sh and print its output without the config file name and times
+run_normalized() {
+    bash "$SHELL_BUN" --no-trust-check "$@" 2>&1 | sed -e 's/same\.\(cfg\|yaml\)/CONFIG/g' -e 's/ ([0-9]*m\?s)//' -e '/^Total time: /d'
+}
+
+@test "YAML: lists the same apps and actions as the INI config" {
+    run run_normalized --list "*" "$BATS_TEST_TMPDIR/same.cfg"
+    local ini="$output"
+    run run_normalized --list "*" "$BATS_TEST_TMPDIR/same.yaml"
+    [ "$status" -eq 0 ]
+    [ "$output" == "$ini" ]
+    [[ "$output" =~ "Api	deploy" ]]
+}
+
+@test "YAML: runs the same commands as the INI config" {
+    run run_normalized --ci "*" "*" --dry-run --sequential "$BATS_TEST_TMPDIR/same.cfg"
+    local ini="$output"
+    run run_normalized --ci "*" "*" --dry-run --sequential "$BATS_TEST_TMPDIR/same.yaml"
+    [ "$output" == "$ini" ]
+    # Settings, env maps, variables and quoting all made it through
+    [[ "$output" =~ "cd '$WORK_DIR' && bash -c export\\ MODE=\\'release\\'\\;\\ export\\ PORT=\\'8080\\'\\;\\ echo\\ \\\"web:\\ built\\\"\\ #\\ kept" ]]
+    [[ "$output" =~ "./deploy.sh\\ \\'prod\\'" ]]
+}
+
+@test "YAML: exports and validates like the INI config" {
+    run run_normalized --export-script Web "$BATS_TEST_TMPDIR/same.cfg"
+    local ini="$output"
+    run run_normalized --export-script Web "$BATS_TEST_TMPDIR/same.yaml"
+    [ "$output" == "$ini" ]
+
+    run run_normalized --validate "$BATS_TEST_TMPDIR/same.cfg"
+    ini=$(echo "$output" | sed 's/CONFIG:[0-9]*/CONFIG/')
+    run run_normalized --validate "$BATS_TEST_TMPDIR/same.yaml"
+    [ "$(echo "$output" | sed 's/CONFIG:[0-9]*/CONFIG/')" == "$ini" ]
+    # Locations are lines of the YAML file
+    [[ "$output" =~ "[Api] deploy: './deploy.sh' not found in $SCRIPT_DIR ($BATS_TEST_TMPDIR/CONFIG:26)" ]]
+}
+
+@test "YAML: --config-format reads other file names as YAML, or .yaml files as INI" {
+    cp "$BATS_TEST_TMPDIR/same.yaml" "$BATS_TEST_TMPDIR/shell-bun.conf"
+    run bash "$SHELL_BUN" --no-trust-check --config-format yaml --list "*" "$BATS_TEST_TMPDIR/shell-bun.conf"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Web	build" ]]
+
+    run bash "$SHELL_BUN" --no-trust-check --config-format=ini --list "*" "$BATS_TEST_TMPDIR/same.yaml"
+    [ "$status" -eq 2 ]
+    [[ "$output" =~ "No applications found" ]]
+
+    run bash "$SHELL_BUN" --config-format xml --list
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "--config-format requires ini, yaml, toml or json" ]]
+}
+
+@test "YAML: includes work from and into INI configs" {
+    printf 'include=extra.yml\n[Ini]\nbuild=echo ini\n' > "$BATS_TEST_TMPDIR/main.cfg"
+    printf 'apps:\n- name: Yaml\n  actions:\n    build: echo yaml\n' > "$BATS_TEST_TMPDIR/extra.yml"
+    run bash "$SHELL_BUN" --no-trust-check --list "*" "$BATS_TEST_TMPDIR/main.cfg"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Ini	build" ]]
+    [[ "$output" =~ "Yaml	build" ]]
+
+    printf 'include: main.cfg\napps:\n- name: Top\n  actions:\n    build: echo top\n' > "$BATS_TEST_TMPDIR/top.yaml"
+    run bash "$SHELL_BUN" --no-trust-check --list "*" "$BATS_TEST_TMPDIR/top.yaml"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Top	build" ]]
+    [[ "$output" =~ "Yaml	build" ]]
+    [[ "$output" =~ "Ini	build" ]]
+}
+
+@test "YAML: commands can span several lines as | and > blocks" {
+    cat > "$BATS_TEST_TMPDIR/blocks.yaml" << EOF
+apps:
+  - name: App
+    actions:
+      build: |
+        # one line after the other
+        echo configure \\
+          --prefix=/usr
+
+        echo make
+        false
+        echo never
+      fold: >
+        echo one
+        two
+    # back in the app
+    shell: bash
+  - name: Other
+    actions:
+      - name: test
+        command: |-
+          echo test
+      - name: lint
+        command: echo lint
+      - name: loop
+        command: |
+          for item in 1 2; do
+            echo "item \$item"
+          done
+          if [ "\$item" = 2 ]; then
+            echo "two items"
+          fi
+EOF
+    run bash "$SHELL_BUN" --no-trust-check --ci App fold --dry-run "$BATS_TEST_TMPDIR/blocks.yaml"
+    [[ "$output" =~ "bash -c echo\\ one\\ two" ]]
+
+    # The block runs as a script that stops at the first failing line
+    run bash "$SHELL_BUN" --no-trust-check --ci App build "$BATS_TEST_TMPDIR/blocks.yaml"
+    [ "$status" -eq 1 ]
+    # It is shown as written, without the set -e it runs with
+    [[ "$output" =~ "bash -c \$'# one line after the other" ]]
+    [ -z "$(echo "$output" | grep 'set -e')" ]
+    echo "$output" | grep -qx "configure --prefix=/usr"
+    echo "$output" | grep -qx "make"
+    [ -z "$(echo "$output" | grep -x never)" ]
+
+    # Loops and if blocks can span several lines
+    run bash "$SHELL_BUN" --no-trust-check --ci Other loop "$BATS_TEST_TMPDIR/blocks.yaml"
+    [ "$status" -eq 0 ]
+    echo "$output" | grep -qx "item 1"
+    echo "$output" | grep -qx "item 2"
+    echo "$output" | grep -qx "two items"
+
+    run bash "$SHELL_BUN" --no-trust-check --list "*" "$BATS_TEST_TMPDIR/blocks.yaml"
+    [ "$status" -eq 0 ]
+    [[ "$output" =~ "Other	test" ]]
+    [[ "$output" =~ "Other	lint" ]]
+}
+
+@test "YAML: what cannot be read is reported with its line" {
+    cat > "$BATS_TEST_TMPDIR/bad.yaml" << EOF
+apps:
+  - name: App
+    working_dir: |
+      /tmp
+      /var
+    actions:
+      test: echo test
+      build: {make: all}
+  - working_dir: /tmp
+    actions:
+      run: echo run
+  - name: Other
+    actions:
+      - name: lint
+      - command: echo nameless
+	bad: 1
+EOF
+    run bash "$SHELL_BUN" --no-trust-check --validate "$BATS_TEST_TMPDIR/bad.yaml"
+    [ "$status" -eq 1 ]
+    [[ "$output" =~ "Ignoring working_dir: only commands can span several lines ($BATS_TEST_TMPDIR/bad.yaml:3)" ]]
+    [[ ! "$output" =~ "line 4" ]]
+    [[ "$output" =~ "Ignoring build: '{make: all}' is a {...} mapping ($BATS_TEST_TMPDIR/bad.yaml:8)" ]]
+    [[ "$output" =~ "Ignoring an app without a name ($BATS_TEST_TMPDIR/bad.yaml:9)" ]]
+    [[ "$output" =~ "[Other] lint: action has no command ($BATS_TEST_TMPDIR/bad.yaml:14)" ]]
+    [[ "$output" =~ "Ignoring an action of [Other] without a name ($BATS_TEST_TMPDIR/bad.yaml:15)" ]]
+    [[ "$output" =~ "YAML is indented with spaces, not tabs ($BATS_TEST_TMPDIR/bad.yaml:16)" ]]
+    # The rest of the file is still read
+    run bash "$SHELL_BUN" --no-trust-check --list App "$BATS_TEST_TMPDIR/bad.yaml"
+    [[ "$output" =~ "App	test" ]]
+    [[ ! "$output" =~ "App	build" ]]
+}